@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+type authorizationKey struct{}
+
+// Authenticate keeps the Authorization header of each GraphQL request, so
+// the calls its resolvers make to the services are made as the same user.
+// The services verify the token themselves.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			r = r.WithContext(context.WithValue(r.Context(), authorizationKey{}, header))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newRequest builds a request to a service that carries the caller's
+// Authorization header
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if header, ok := ctx.Value(authorizationKey{}).(string); ok {
+		req.Header.Set("Authorization", header)
+	}
+	return req, nil
+}
+
+// send makes a request to a service on behalf of the caller
+func send(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := newRequest(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
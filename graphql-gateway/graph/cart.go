@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// cartRequest sends a request for a cart to the order service, as the
+// logged-in user or for the guest cart given
+func cartRequest(ctx context.Context, method, path string, cartID *string, body interface{}, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %v", err)
+		}
+		payload = bytes.NewBuffer(data)
+	}
+	req, err := newRequest(ctx, method, "http://localhost:8083"+path, payload)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	if cartID != nil {
+		req.Header.Set("X-Cart-ID", *cartID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("order service returned %s: %s", resp.Status, string(data))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
@@ -2,49 +2,160 @@
 
 package model
 
+type AppliedCoupon struct {
+	Code     string `json:"code"`
+	Discount *Money `json:"discount"`
+}
 
-type Mutation struct {
+type AppliedPromotion struct {
+	PromotionID string `json:"promotion_id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Discount    *Money `json:"discount"`
 }
 
-type Order struct {
-	ID       string `json:"id", bson:"_id"`
+type BundleComponent struct {
 	Name     string `json:"name"`
 	Quantity int    `json:"quantity"`
-	Status   string `json:"status"`
 }
 
-type OrderInput struct {
+type Cancellation struct {
+	Reason    string  `json:"reason"`
+	Actor     *string `json:"actor,omitempty"`
+	Forced    *bool   `json:"forced,omitempty"`
+	Expired   *bool   `json:"expired,omitempty"`
+	Payment   *string `json:"payment,omitempty"`
+	Completed bool    `json:"completed"`
+	At        string  `json:"at"`
+}
+
+type Cart struct {
+	ID       string      `json:"id"`
+	UserID   *string     `json:"user_id,omitempty"`
+	Items    []*CartItem `json:"items"`
+	Currency *string     `json:"currency,omitempty"`
+	Subtotal *Money      `json:"subtotal"`
+}
+
+type CartItem struct {
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice *Money  `json:"unit_price,omitempty"`
+	LineTotal *Money  `json:"line_total,omitempty"`
+	Available int     `json:"available"`
+	Error     *string `json:"error,omitempty"`
+}
+
+type LineItem struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Sku       *string `json:"sku,omitempty"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice *Money  `json:"unit_price"`
+	LineTotal *Money  `json:"line_total"`
+	Returned  *int    `json:"returned,omitempty"`
+}
+
+type LineItemInput struct {
 	Name     string `json:"name"`
 	Quantity int    `json:"quantity"`
-	Status   string `json:"status"`
+}
+
+type Money struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type MoneyInput struct {
+	Amount   int     `json:"amount"`
+	Currency *string `json:"currency,omitempty"`
+}
+
+type Mutation struct {
+}
+
+type Order struct {
+	ID            string              `json:"id"`
+	Number        string              `json:"number"`
+	UserID        *string             `json:"user_id,omitempty"`
+	Items         []*LineItem         `json:"items"`
+	Subtotal      *Money              `json:"subtotal,omitempty"`
+	Discount      *Money              `json:"discount,omitempty"`
+	Tax           *Money              `json:"tax,omitempty"`
+	Total         *Money              `json:"total,omitempty"`
+	Refunded      *Money              `json:"refunded,omitempty"`
+	Promotions    []*AppliedPromotion `json:"promotions,omitempty"`
+	Coupon        *AppliedCoupon      `json:"coupon,omitempty"`
+	Status        string              `json:"status"`
+	StatusHistory []*StatusChange     `json:"status_history,omitempty"`
+	Cancellation  *Cancellation       `json:"cancellation,omitempty"`
+}
+
+type OrderInput struct {
+	Items      []*LineItemInput `json:"items"`
+	Currency   *string          `json:"currency,omitempty"`
+	CouponCode *string          `json:"coupon_code,omitempty"`
 }
 
 type Product struct {
-	ID          string  `json:"id", bson:"_id"`
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Description     *string                `json:"description,omitempty"`
+	Category        *string                `json:"category,omitempty"`
+	Attributes      map[string]interface{} `json:"attributes,omitempty"`
+	Price           *Money                 `json:"price"`
+	Quantity        int                    `json:"quantity"`
+	Images          []*ProductImage        `json:"images,omitempty"`
+	Rating          *Rating                `json:"rating,omitempty"`
+	Type            *string                `json:"type,omitempty"`
+	Components      []*BundleComponent     `json:"components,omitempty"`
+	Recommendations []*Product             `json:"recommendations"`
+}
+
+type ProductImage struct {
+	ID         string       `json:"id"`
+	URL        string       `json:"url"`
+	Thumbnails []*Thumbnail `json:"thumbnails"`
+	Position   int          `json:"position"`
+	Primary    bool         `json:"primary"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description *string `json:"description,omitempty"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	Name        string      `json:"name"`
+	Description *string     `json:"description,omitempty"`
+	Price       *MoneyInput `json:"price"`
+	Quantity    int         `json:"quantity"`
 }
 
 type Query struct {
 }
 
+type Rating struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
 type RegisterInput struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type StatusChange struct {
+	From   *string `json:"from,omitempty"`
+	Status string  `json:"status"`
+	Actor  *string `json:"actor,omitempty"`
+	Note   *string `json:"note,omitempty"`
+	At     string  `json:"at"`
+}
+
+type Thumbnail struct {
+	Size string `json:"size"`
+	URL  string `json:"url"`
+}
+
 type User struct {
-	ID       string `json:"id", bson:"_id"`
+	ID       string `json:"id"`
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -14,6 +14,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 )
 
 // RegisterUser is the resolver for the registerUser field.
@@ -31,7 +32,7 @@ func (r *mutationResolver) RegisterUser(ctx context.Context, input model.Registe
 	}
 
 	// Send the POST request to the user service running on localhost:8081
-	resp, err := http.Post("http://localhost:8081/register", "application/json", bytes.NewBuffer(jsonPayload))
+	resp, err := send(ctx, http.MethodPost, "http://localhost:8081/register", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to user service: %v", err)
 	}
@@ -68,7 +69,7 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, input model.Produc
 	}
 
 	// Send the POST request to the product service running on localhost:8082
-	resp, err := http.Post("http://localhost:8082/product", "application/json", bytes.NewBuffer(jsonPayload))
+	resp, err := send(ctx, http.MethodPost, "http://localhost:8082/product", bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to product service")
 	}
@@ -114,7 +115,7 @@ func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, input m
 	}
 
 	// Create a new PUT request to the product service running on localhost:8082
-	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("http://localhost:8082/product/%s", id), bytes.NewBuffer(jsonPayload))
+	req, err := newRequest(ctx, http.MethodPut, fmt.Sprintf("http://localhost:8082/product/%s", id), bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %v", err)
 	}
@@ -150,7 +151,7 @@ func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, input m
 // DeleteProduct is the resolver for the deleteProduct field.
 func (r *mutationResolver) DeleteProduct(ctx context.Context, id string) (bool, error) {
 	// Create a new DELETE request to the product service running on localhost:8082
-	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://localhost:8082/products/%s", id), nil)
+	req, err := newRequest(ctx, http.MethodDelete, fmt.Sprintf("http://localhost:8082/products/%s", id), nil)
 	if err != nil {
 		return false, fmt.Errorf("error creating request: %v", err)
 	}
@@ -173,32 +174,16 @@ func (r *mutationResolver) DeleteProduct(ctx context.Context, id string) (bool,
 
 // PlaceOrder is the resolver for the placeOrder field.
 func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInput) (*model.Order, error) {
-	productURL := fmt.Sprintf("http://localhost:8082/product/%s", input.Name)
-	log.Printf("Fetching product details from URL: %s", productURL)
-
-	productResp, err := http.Get(productURL)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching product details: %v", err)
+	// Create the order in the order service, which prices every item. It is
+	// priced in the requested currency when one is given.
+	order := map[string]interface{}{
+		"items": input.Items,
 	}
-	defer productResp.Body.Close()
-
-	// Check the response status
-	if productResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(productResp.Body)
-		return nil, fmt.Errorf("error fetching product details: %s, %s", productResp.Status, string(body))
+	if input.Currency != nil {
+		order["currency"] = *input.Currency
 	}
-
-	// Decode the response into the Product model
-	var product model.Product
-	if err := json.NewDecoder(productResp.Body).Decode(&product); err != nil {
-		return nil, fmt.Errorf("error decoding product details: %v", err)
-	}
-
-	// Create the order in the order service
-	order := &model.Order{
-		Name:     product.Name,
-		Quantity: input.Quantity,
-		Status:   input.Status,
+	if input.CouponCode != nil {
+		order["coupon_code"] = *input.CouponCode
 	}
 
 	orderJSON, err := json.Marshal(order)
@@ -206,7 +191,7 @@ func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInpu
 		return nil, fmt.Errorf("error marshaling order: %v", err)
 	}
 
-	resp, err := http.Post("http://localhost:8083/order", "application/json", bytes.NewBuffer(orderJSON))
+	resp, err := send(ctx, http.MethodPost, "http://localhost:8083/order", bytes.NewBuffer(orderJSON))
 	if err != nil {
 		return nil, fmt.Errorf("error creating order: %v", err)
 	}
@@ -228,13 +213,131 @@ func (r *mutationResolver) PlaceOrder(ctx context.Context, input model.OrderInpu
 
 // UpdateOrderStatus is the resolver for the updateOrderStatus field.
 func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, id string, status string) (*model.Order, error) {
-	panic(fmt.Errorf("not implemented"))
+	statusJSON, err := json.Marshal(map[string]string{"status": status})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling status: %v", err)
+	}
+
+	req, err := newRequest(ctx, http.MethodPut, fmt.Sprintf("http://localhost:8083/order/%s", url.PathEscape(id)), bytes.NewBuffer(statusJSON))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Invalid transitions come back with the statuses the order can move to
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error updating order status: %s", string(body))
+	}
+
+	var order model.Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	utils.EmitEvents("Order Status Updated")
+
+	return &order, nil
+}
+
+// CancelOrder is the resolver for the cancelOrder field.
+func (r *mutationResolver) CancelOrder(ctx context.Context, id string, reason string) (*model.Order, error) {
+	reasonJSON, err := json.Marshal(map[string]string{"reason": reason})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling reason: %v", err)
+	}
+
+	req, err := newRequest(ctx, http.MethodPost, fmt.Sprintf("http://localhost:8083/order/%s/cancel", url.PathEscape(id)), bytes.NewBuffer(reasonJSON))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to order service: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("error cancelling order: %s", string(body))
+	}
+
+	var order model.Order
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	utils.EmitEvents("Order Cancelled")
+
+	return &order, nil
+}
+
+// AddToCart is the resolver for the addToCart field.
+func (r *mutationResolver) AddToCart(ctx context.Context, cartID *string, name string, quantity int) (*model.Cart, error) {
+	// Without a cart_id or user_id a new guest cart is started, returned as id
+	var cart model.Cart
+	body := map[string]interface{}{"name": name, "quantity": quantity}
+	if err := cartRequest(ctx, http.MethodPost, "/cart/items", cartID, body, &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// Checkout is the resolver for the checkout field.
+func (r *mutationResolver) Checkout(ctx context.Context, cartID *string, currency *string, couponCode *string) (*model.Order, error) {
+	body := map[string]interface{}{}
+	if currency != nil {
+		body["currency"] = *currency
+	}
+	if couponCode != nil {
+		body["coupon_code"] = *couponCode
+	}
+	var order model.Order
+	if err := cartRequest(ctx, http.MethodPost, "/cart/checkout", cartID, body, &order); err != nil {
+		return nil, err
+	}
+	utils.EmitEvents("Order Placed")
+	return &order, nil
+}
+
+// Recommendations is the resolver for the recommendations field.
+func (r *productResolver) Recommendations(ctx context.Context, obj *model.Product, limit *int) ([]*model.Product, error) {
+	// Send the GET request to the product service running on localhost:8082
+	recommendationsURL := fmt.Sprintf("http://localhost:8082/product/%s/recommendations", url.PathEscape(obj.Name))
+	if limit != nil {
+		recommendationsURL += fmt.Sprintf("?limit=%d", *limit)
+	}
+	resp, err := send(ctx, http.MethodGet, recommendationsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching recommendations: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Check the response status
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("Received non-OK response: %v, body: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("received non-OK response from product service: %v", resp.Status)
+	}
+
+	// Decode the response into a slice of Product models
+	var products []*model.Product
+	if err := json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+	return products, nil
 }
 
 // Users is the resolver for the users field.
 func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 	// Send the GET request to the user service running on localhost:8081
-	resp, err := http.Get("http://localhost:8081/users")
+	resp, err := send(ctx, http.MethodGet, "http://localhost:8081/users", nil)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to user service: %v", err)
 	}
@@ -259,7 +362,7 @@ func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 // User is the resolver for the user field.
 func (r *queryResolver) User(ctx context.Context, name string) (*model.User, error) {
 	// Send the GET request to the user service running on localhost:8081
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8081/user/%s", name))
+	resp, err := send(ctx, http.MethodGet, fmt.Sprintf("http://localhost:8081/user/%s", name), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to user service: %v", err)
 	}
@@ -281,9 +384,23 @@ func (r *queryResolver) User(ctx context.Context, name string) (*model.User, err
 }
 
 // Products is the resolver for the products field.
-func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error) {
+func (r *queryResolver) Products(ctx context.Context, currency *string, category *string, attributes map[string]interface{}) ([]*model.Product, error) {
 	// Send the GET request to the product service running on localhost:8082
-	resp, err := http.Get("http://localhost:8082/products")
+	query := url.Values{}
+	if currency != nil && *currency != "" {
+		query.Set("currency", *currency)
+	}
+	if category != nil && *category != "" {
+		query.Set("category", *category)
+	}
+	for name, value := range attributes {
+		query.Set("attr."+name, fmt.Sprint(value))
+	}
+	productsURL := "http://localhost:8082/products"
+	if len(query) > 0 {
+		productsURL += "?" + query.Encode()
+	}
+	resp, err := send(ctx, http.MethodGet, productsURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching products: %v", err)
 	}
@@ -307,9 +424,13 @@ func (r *queryResolver) Products(ctx context.Context) ([]*model.Product, error)
 }
 
 // Product is the resolver for the product field.
-func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product, error) {
+func (r *queryResolver) Product(ctx context.Context, id string, currency *string) (*model.Product, error) {
 	// Send the GET request to the product service running on localhost:8082
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8082/product/%s", id))
+	productURL := fmt.Sprintf("http://localhost:8082/product/%s", id)
+	if currency != nil && *currency != "" {
+		productURL += "?currency=" + url.QueryEscape(*currency)
+	}
+	resp, err := send(ctx, http.MethodGet, productURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching product: %v", err)
 	}
@@ -334,7 +455,7 @@ func (r *queryResolver) Product(ctx context.Context, id string) (*model.Product,
 // Orders is the resolver for the orders field.
 func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
 	// Send the GET request to the order service running on localhost:8083
-	resp, err := http.Get("http://localhost:8083/orders")
+	resp, err := send(ctx, http.MethodGet, "http://localhost:8083/orders", nil)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to order service: %v", err)
 	}
@@ -359,7 +480,7 @@ func (r *queryResolver) Orders(ctx context.Context) ([]*model.Order, error) {
 // Order is the resolver for the order field.
 func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, error) {
 	// Send the GET request to the order service running on localhost:8083
-	resp, err := http.Get(fmt.Sprintf("http://localhost:8083/order/%s", id))
+	resp, err := send(ctx, http.MethodGet, fmt.Sprintf("http://localhost:8083/order/%s", id), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request to order service: %v", err)
 	}
@@ -379,11 +500,28 @@ func (r *queryResolver) Order(ctx context.Context, id string) (*model.Order, err
 	return &order, nil
 }
 
+// Cart is the resolver for the cart field.
+func (r *queryResolver) Cart(ctx context.Context, cartID *string, currency *string) (*model.Cart, error) {
+	path := "/cart"
+	if currency != nil {
+		path += "?currency=" + url.QueryEscape(*currency)
+	}
+	var cart model.Cart
+	if err := cartRequest(ctx, http.MethodGet, path, cartID, nil, &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Product returns ProductResolver implementation.
+func (r *Resolver) Product() ProductResolver { return &productResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
 type mutationResolver struct{ *Resolver }
+type productResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
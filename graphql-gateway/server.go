@@ -21,7 +21,7 @@ func main() {
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
 	utils.InitRabbitMQ()
 	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	http.Handle("/query", graph.Authenticate(srv))
 
 	log.Printf("connect to http://127.0.0.1:8080:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
@@ -0,0 +1,190 @@
+package cancellation
+
+import (
+	"context"
+	"errors"
+	"order-service/coupon"
+	"order-service/db"
+	"order-service/lifecycle"
+	"order-service/model"
+	"order-service/payment"
+	"order-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Outcomes of the payment of a cancelled order
+const (
+	PaymentVoided   = "voided"
+	PaymentRefunded = "refunded"
+	PaymentNone     = "none"
+)
+
+// ReasonInventory is the reason stock of a cancelled order is put back with
+// in the product service's ledger
+const ReasonInventory = "cancellation"
+
+// Cancel cancels the order matching filter for reason, then puts its stock
+// back, voids or refunds its payment and gives back its coupon. Only orders
+// the lifecycle lets move to cancelled can be, unless force is set, which
+// cancels any order that isn't cancelled or refunded yet.
+//
+// The order is cancelled first, so nothing else can move it while it's
+// undone. If undoing it fails, the order is returned with the error and
+// cancelling it again carries on where it stopped.
+func Cancel(ctx context.Context, filter bson.M, actor, reason string, force bool) (*model.Order, error) {
+	return cancel(ctx, filter, lifecycle.Change{
+		Status: model.StatusCancelled,
+		Actor:  actor,
+		Note:   reason,
+		Force:  force,
+		Set: bson.M{"cancellation": model.Cancellation{
+			Reason: reason,
+			Actor:  actor,
+			Forced: force,
+			At:     time.Now().UTC(),
+		}},
+	})
+}
+
+// Expire cancels the order matching filter, if it's still pending, because
+// it wasn't paid in time. Besides order.cancelled it publishes order.expired.
+func Expire(ctx context.Context, filter bson.M, actor, reason string) (*model.Order, error) {
+	now := time.Now().UTC()
+	return cancel(ctx, filter, lifecycle.Change{
+		Status: model.StatusCancelled,
+		Actor:  actor,
+		Note:   reason,
+		Set: bson.M{"cancellation": model.Cancellation{
+			Reason:  reason,
+			Actor:   actor,
+			Expired: true,
+			At:      now,
+		}},
+		Stage: func(ctx context.Context, order *model.Order) error {
+			items := make([]model.EventItem, 0, len(order.Items))
+			for _, item := range order.Items {
+				items = append(items, model.EventItem{ProductName: item.ProductName, Quantity: item.Quantity})
+			}
+			return utils.StageEvent(ctx, model.EventOrderExpired, model.OrderExpiredEvent{
+				OrderID:   order.ID.Hex(),
+				Number:    order.Number,
+				UserID:    order.UserID,
+				Items:     items,
+				PlacedAt:  order.ID.Timestamp().UTC(),
+				ExpiredAt: now,
+			})
+		},
+	})
+}
+
+func cancel(ctx context.Context, filter bson.M, change lifecycle.Change) (*model.Order, error) {
+	order, err := lifecycle.Apply(ctx, filter, change)
+	var transitionErr *lifecycle.TransitionError
+	if errors.As(err, &transitionErr) && transitionErr.From == model.StatusCancelled {
+		var current model.Order
+		if err := db.MI.DB.Collection("orders").FindOne(ctx, filter).Decode(&current); err != nil {
+			return nil, err
+		}
+		if current.Cancellation == nil || current.Cancellation.Completed {
+			return nil, transitionErr
+		}
+		order = &current
+	} else if err != nil {
+		return nil, err
+	}
+
+	return order, Complete(ctx, order)
+}
+
+// Complete undoes whatever part of a cancelled order hasn't been undone,
+// saving progress after each part
+func Complete(ctx context.Context, order *model.Order) error {
+	c := order.Cancellation
+	orders := db.MI.DB.Collection("orders")
+	save := func(field string, value interface{}) error {
+		_, err := orders.UpdateOne(ctx, bson.M{"_id": order.ID}, bson.M{"$set": bson.M{"cancellation." + field: value}})
+		return err
+	}
+
+	restocked := make(map[string]bool, len(c.Restocked))
+	for _, name := range c.Restocked {
+		restocked[name] = true
+	}
+	for _, item := range order.Items {
+		if restocked[item.ProductName] {
+			continue
+		}
+		// Units asked back by returns are restocked when the return is
+		// received, not by the cancellation
+		if quantity := item.Quantity - item.Returned; quantity > 0 {
+			// Archived products hold no stock to give back to
+			err := utils.UpdateProductInventory(item.ProductName, quantity, ReasonInventory, order.ID.Hex())
+			if err != nil && !errors.Is(err, utils.ErrProductArchived) {
+				return err
+			}
+		}
+		c.Restocked = append(c.Restocked, item.ProductName)
+		if err := save("restocked", c.Restocked); err != nil {
+			return err
+		}
+	}
+
+	if c.Payment == "" {
+		outcome, err := settlePayment(ctx, order.ID.Hex())
+		if err != nil {
+			return err
+		}
+		c.Payment = outcome
+		if err := save("payment", outcome); err != nil {
+			return err
+		}
+	}
+
+	if order.Coupon != nil && !c.CouponReleased {
+		if err := coupon.Release(ctx, &model.Coupon{Code: order.Coupon.Code}, order.UserID); err != nil {
+			return err
+		}
+		c.CouponReleased = true
+		if err := save("coupon_released", true); err != nil {
+			return err
+		}
+	}
+
+	c.Completed = true
+	return save("completed", true)
+}
+
+// settlePayment voids an authorized payment, or refunds what is left of a
+// captured one
+func settlePayment(ctx context.Context, orderID string) (string, error) {
+	intent, err := payment.Find(ctx, orderID)
+	if err == mongo.ErrNoDocuments {
+		// Placed before payments were recorded
+		return PaymentNone, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch intent.Status {
+	case model.PaymentAuthorized:
+		if _, err := payment.Void(ctx, orderID); err != nil {
+			return "", err
+		}
+		return PaymentVoided, nil
+	case model.PaymentCaptured, model.PaymentPartiallyRefunded:
+		remaining := model.Money{Amount: intent.Captured.Amount - intent.Refunded.Amount, Currency: intent.Captured.Currency}
+		if _, err := payment.Refund(ctx, orderID, remaining, payment.CancellationRefund(orderID)); err != nil {
+			return "", err
+		}
+		return PaymentRefunded, nil
+	case model.PaymentVoided:
+		return PaymentVoided, nil
+	case model.PaymentRefunded:
+		return PaymentRefunded, nil
+	}
+	return PaymentNone, nil
+}
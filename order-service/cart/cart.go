@@ -0,0 +1,146 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"order-service/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNoCart = errors.New("no cart given, send X-User-ID or X-Cart-ID")
+
+// GuestTTL is how long a guest cart lives after its last change. Carts of
+// logged-in users don't expire.
+var GuestTTL = 7 * 24 * time.Hour
+
+// Ref identifies a cart: the cart of a logged-in user, or a guest cart by
+// the ID it was handed out with
+type Ref struct {
+	UserID  string
+	GuestID string
+}
+
+// NewGuest returns a reference to a new guest cart
+func NewGuest() Ref {
+	return Ref{GuestID: primitive.NewObjectID().Hex()}
+}
+
+// ID is what the cart is known by to its owner
+func (r Ref) ID() string {
+	if r.UserID != "" {
+		return r.UserID
+	}
+	return r.GuestID
+}
+
+func (r Ref) key() (string, error) {
+	switch {
+	case r.UserID != "":
+		return "cart:user:" + r.UserID, nil
+	case r.GuestID != "":
+		return "cart:guest:" + r.GuestID, nil
+	}
+	return "", ErrNoCart
+}
+
+// touch keeps a guest cart alive for another GuestTTL
+func (r Ref) touch(ctx context.Context, pipe redis.Pipeliner, key string) {
+	if r.UserID == "" {
+		pipe.Expire(ctx, key, GuestTTL)
+	}
+}
+
+// Items returns the quantity of each product in the cart
+func Items(ctx context.Context, r Ref) (map[string]int, error) {
+	key, err := r.key()
+	if err != nil {
+		return nil, err
+	}
+	fields, err := utils.RDB.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]int, len(fields))
+	for name, value := range fields {
+		if quantity, err := strconv.Atoi(value); err == nil && quantity > 0 {
+			items[name] = quantity
+		}
+	}
+	return items, nil
+}
+
+// Add adds quantity of a product to the cart and returns the new quantity
+func Add(ctx context.Context, r Ref, productName string, quantity int) (int, error) {
+	key, err := r.key()
+	if err != nil {
+		return 0, err
+	}
+	pipe := utils.RDB.TxPipeline()
+	total := pipe.HIncrBy(ctx, key, productName, int64(quantity))
+	r.touch(ctx, pipe, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(total.Val()), nil
+}
+
+// Set sets the quantity of a product in the cart, removing it at 0
+func Set(ctx context.Context, r Ref, productName string, quantity int) error {
+	key, err := r.key()
+	if err != nil {
+		return err
+	}
+	pipe := utils.RDB.TxPipeline()
+	if quantity > 0 {
+		pipe.HSet(ctx, key, productName, quantity)
+	} else {
+		pipe.HDel(ctx, key, productName)
+	}
+	r.touch(ctx, pipe, key)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Remove takes a product out of the cart
+func Remove(ctx context.Context, r Ref, productName string) error {
+	return Set(ctx, r, productName, 0)
+}
+
+// Clear empties the cart
+func Clear(ctx context.Context, r Ref) error {
+	key, err := r.key()
+	if err != nil {
+		return err
+	}
+	return utils.RDB.Del(ctx, key).Err()
+}
+
+// Merge moves the items of a guest cart into a user's cart, adding up the
+// quantities of products in both, and deletes the guest cart
+func Merge(ctx context.Context, guestID, userID string) (map[string]int, error) {
+	guest := Ref{GuestID: guestID}
+	items, err := Items(ctx, guest)
+	if err != nil {
+		return nil, err
+	}
+	user := Ref{UserID: userID}
+	key, err := user.key()
+	if err != nil {
+		return nil, err
+	}
+	guestKey, _ := guest.key()
+
+	pipe := utils.RDB.TxPipeline()
+	for name, quantity := range items {
+		pipe.HIncrBy(ctx, key, name, int64(quantity))
+	}
+	pipe.Del(ctx, guestKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return Items(ctx, user)
+}
@@ -0,0 +1,177 @@
+package coupon
+
+import (
+	"context"
+	"errors"
+	"math"
+	"order-service/db"
+	"order-service/model"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotFound         = errors.New("coupon not found")
+	ErrExpired          = errors.New("coupon has expired")
+	ErrLimitReached     = errors.New("coupon has been fully redeemed")
+	ErrUserLimitReached = errors.New("you have already redeemed this coupon the maximum number of times")
+	ErrUserRequired     = errors.New("coupon can only be redeemed by an identified user")
+	ErrMinimumNotMet    = errors.New("order does not reach the coupon's minimum value")
+	ErrCurrency         = errors.New("coupon is not valid for the order's currency")
+)
+
+// Init creates the unique indexes redemption relies on
+func Init() error {
+	indexes := map[string]mongo.IndexModel{
+		"coupons":            {Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		"coupon_redemptions": {Keys: bson.D{{Key: "code", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	for collection, indexModel := range indexes {
+		if _, err := db.MI.DB.Collection(collection).Indexes().CreateOne(context.TODO(), indexModel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NormalizeCode makes codes case-insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks a coupon has the parameters its type needs
+func Validate(c *model.Coupon) error {
+	switch c.Type {
+	case model.CouponPercentage:
+		if c.Percent <= 0 || c.Percent > 100 {
+			return errors.New("percent must be between 0 and 100")
+		}
+	case model.CouponFixed:
+		if c.Amount == nil || c.Amount.Amount <= 0 || c.Amount.Currency == "" {
+			return errors.New("amount with a positive amount and a currency is required")
+		}
+	}
+	if c.MinOrderValue != nil && c.MinOrderValue.Currency == "" {
+		return errors.New("min_order_value needs a currency")
+	}
+	return nil
+}
+
+// Find returns the coupon with the given code if it has not expired
+func Find(ctx context.Context, code string) (*model.Coupon, error) {
+	var c model.Coupon
+	err := db.MI.DB.Collection("coupons").FindOne(ctx, bson.M{"code": NormalizeCode(code)}).Decode(&c)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now()) {
+		return nil, ErrExpired
+	}
+	return &c, nil
+}
+
+// Discount returns what a coupon takes off an order total
+func Discount(c *model.Coupon, total model.Money) (model.Money, error) {
+	if c.MinOrderValue != nil {
+		if c.MinOrderValue.Currency != total.Currency {
+			return model.Money{}, ErrCurrency
+		}
+		if total.Amount < c.MinOrderValue.Amount {
+			return model.Money{}, ErrMinimumNotMet
+		}
+	}
+
+	discount := model.Money{Currency: total.Currency}
+	switch c.Type {
+	case model.CouponPercentage:
+		discount.Amount = int64(math.Round(float64(total.Amount) * c.Percent / 100))
+	case model.CouponFixed:
+		if c.Amount.Currency != total.Currency {
+			return model.Money{}, ErrCurrency
+		}
+		discount.Amount = c.Amount.Amount
+	}
+	if discount.Amount > total.Amount {
+		discount.Amount = total.Amount
+	}
+	return discount, nil
+}
+
+// Redeem uses up one redemption of a coupon for a user. The global count is
+// taken with a conditional increment and the per-user count with an upsert
+// guarded by a unique index, so concurrent orders cannot exceed either limit.
+func Redeem(ctx context.Context, c *model.Coupon, userID string) error {
+	if c.MaxPerUser > 0 && userID == "" {
+		return ErrUserRequired
+	}
+
+	filter := bson.M{
+		"code": c.Code,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"expires_at": nil}, bson.M{"expires_at": bson.M{"$gt": time.Now()}}}},
+			bson.M{"$or": bson.A{
+				bson.M{"max_redemptions": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$redemptions", "$max_redemptions"}}},
+			}},
+		},
+	}
+	result, err := db.MI.DB.Collection("coupons").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"redemptions": 1}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		if c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now()) {
+			return ErrExpired
+		}
+		return ErrLimitReached
+	}
+
+	if userID == "" {
+		return nil
+	}
+	userFilter := bson.M{"code": c.Code, "user_id": userID}
+	if c.MaxPerUser > 0 {
+		userFilter["count"] = bson.M{"$lt": c.MaxPerUser}
+	}
+	_, err = db.MI.DB.Collection("coupon_redemptions").UpdateOne(ctx, userFilter,
+		bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"last_redeemed_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		// Give back the global redemption taken above
+		releaseGlobal(ctx, c.Code)
+		if mongo.IsDuplicateKeyError(err) {
+			// The user's redemption record exists and is at the limit
+			return ErrUserLimitReached
+		}
+		return err
+	}
+	return nil
+}
+
+// Release gives back a redemption when the order it was taken for fails
+func Release(ctx context.Context, c *model.Coupon, userID string) error {
+	if err := releaseGlobal(ctx, c.Code); err != nil {
+		return err
+	}
+	if userID == "" {
+		return nil
+	}
+	_, err := db.MI.DB.Collection("coupon_redemptions").UpdateOne(ctx,
+		bson.M{"code": c.Code, "user_id": userID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+func releaseGlobal(ctx context.Context, code string) error {
+	_, err := db.MI.DB.Collection("coupons").UpdateOne(ctx,
+		bson.M{"code": code, "redemptions": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"redemptions": -1}})
+	return err
+}
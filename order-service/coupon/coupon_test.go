@@ -0,0 +1,145 @@
+package coupon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/db"
+	"order-service/model"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var (
+	updated    = mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+	notUpdated = mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0})
+	duplicate  = mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"})
+)
+
+func TestRedeem(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		coupon    model.Coupon
+		userID    string
+		responses []bson.D
+		wantErr   error
+		// wantIncs lists the redemption counter changes sent, in order
+		wantIncs []string
+	}{
+		{
+			name:      "unlimited coupon without a user",
+			coupon:    model.Coupon{Code: "WELCOME"},
+			responses: []bson.D{updated},
+			wantIncs:  []string{"redemptions:1"},
+		},
+		{
+			name:      "per-user limit counts the user's redemptions",
+			coupon:    model.Coupon{Code: "ONCE", MaxPerUser: 1},
+			userID:    "alice",
+			responses: []bson.D{updated, updated},
+			wantIncs:  []string{"redemptions:1", "count:1"},
+		},
+		{
+			name:    "per-user limit needs a user",
+			coupon:  model.Coupon{Code: "ONCE", MaxPerUser: 1},
+			wantErr: ErrUserRequired,
+		},
+		{
+			name:      "global limit reached",
+			coupon:    model.Coupon{Code: "FIRST100", MaxRedemptions: 100},
+			userID:    "alice",
+			responses: []bson.D{notUpdated},
+			wantErr:   ErrLimitReached,
+			wantIncs:  []string{"redemptions:1"},
+		},
+		{
+			name:      "expired while redeeming",
+			coupon:    model.Coupon{Code: "OLD", ExpiresAt: &past},
+			responses: []bson.D{notUpdated},
+			wantErr:   ErrExpired,
+			wantIncs:  []string{"redemptions:1"},
+		},
+		{
+			name:      "user limit reached gives back the global redemption",
+			coupon:    model.Coupon{Code: "ONCE", MaxPerUser: 1},
+			userID:    "alice",
+			responses: []bson.D{updated, duplicate, updated},
+			wantErr:   ErrUserLimitReached,
+			wantIncs:  []string{"redemptions:1", "count:1", "redemptions:-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			db.MI.DB = mt.DB
+			mt.AddMockResponses(tt.responses...)
+
+			err := Redeem(context.Background(), &tt.coupon, tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			var incs []string
+			for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+				update := event.Command.Lookup("updates").Array().Index(0).Value().Document()
+				inc := update.Lookup("u", "$inc").Document().Index(0)
+				incs = append(incs, fmt.Sprintf("%s:%d", inc.Key(), inc.Value().AsInt64()))
+
+				// Per-user redemptions are only taken below the limit
+				if inc.Key() == "count" && tt.coupon.MaxPerUser > 0 {
+					limit, ok := update.Lookup("q", "count", "$lt").AsInt64OK()
+					if !ok || limit != int64(tt.coupon.MaxPerUser) {
+						mt.Errorf("per-user filter = %v, want count below %d", update.Lookup("q"), tt.coupon.MaxPerUser)
+					}
+				}
+			}
+			if len(incs) != len(tt.wantIncs) {
+				mt.Fatalf("updates = %v, want %v", incs, tt.wantIncs)
+			}
+			for i := range incs {
+				if incs[i] != tt.wantIncs[i] {
+					mt.Errorf("updates = %v, want %v", incs, tt.wantIncs)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	eur := func(amount int64) *model.Money { return &model.Money{Amount: amount, Currency: "EUR"} }
+
+	tests := []struct {
+		name    string
+		coupon  model.Coupon
+		total   model.Money
+		want    int64
+		wantErr error
+	}{
+		{"percentage", model.Coupon{Type: model.CouponPercentage, Percent: 15}, *eur(2000), 300, nil},
+		{"percentage rounds", model.Coupon{Type: model.CouponPercentage, Percent: 33}, *eur(1001), 330, nil},
+		{"fixed", model.Coupon{Type: model.CouponFixed, Amount: eur(500)}, *eur(2000), 500, nil},
+		{"fixed capped at the total", model.Coupon{Type: model.CouponFixed, Amount: eur(5000)}, *eur(2000), 2000, nil},
+		{"fixed in another currency", model.Coupon{Type: model.CouponFixed, Amount: &model.Money{Amount: 500, Currency: "USD"}}, *eur(2000), 0, ErrCurrency},
+		{"minimum met", model.Coupon{Type: model.CouponPercentage, Percent: 10, MinOrderValue: eur(2000)}, *eur(2000), 200, nil},
+		{"minimum not met", model.Coupon{Type: model.CouponPercentage, Percent: 10, MinOrderValue: eur(2000)}, *eur(1999), 0, ErrMinimumNotMet},
+		{"minimum in another currency", model.Coupon{Type: model.CouponPercentage, Percent: 10, MinOrderValue: &model.Money{Amount: 100, Currency: "USD"}}, *eur(2000), 0, ErrCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Discount(&tt.coupon, tt.total)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("discount = %d, want %d", got.Amount, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateMoney converts orders stored before prices carried a currency. The
+// old price is taken to be in the given currency, with unit minor units per
+// major unit, and the total is derived from it.
+func MigrateMoney(ctx context.Context, currency string, unit int64) error {
+	amount := bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$price", unit}}, 0}}}
+	result, err := MI.DB.Collection("orders").UpdateMany(ctx,
+		bson.M{"price": bson.M{"$type": "number"}},
+		bson.A{
+			bson.M{"$set": bson.M{"price": bson.M{"amount": amount, "currency": currency}}},
+			bson.M{"$set": bson.M{"total": bson.M{
+				"amount":   bson.M{"$multiply": bson.A{"$price.amount", "$quantity"}},
+				"currency": currency,
+			}}},
+		})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated %d orders to %s prices", result.ModifiedCount, currency)
+	}
+	return nil
+}
+
+// MigrateLineItems converts orders stored with a single product and quantity
+// into orders with one line item, and numbers orders placed before orders
+// had numbers
+func MigrateLineItems(ctx context.Context) error {
+	result, err := MI.DB.Collection("orders").UpdateMany(ctx,
+		bson.M{"items": bson.M{"$exists": false}, "name": bson.M{"$exists": true}},
+		bson.A{
+			bson.M{"$set": bson.M{
+				"items": bson.A{bson.M{
+					"product_id": "",
+					"name":       "$name",
+					"quantity":   "$quantity",
+					"unit_price": "$price",
+					"line_total": bson.M{
+						"amount":   bson.M{"$multiply": bson.A{"$price.amount", "$quantity"}},
+						"currency": "$price.currency",
+					},
+				}},
+				"subtotal": bson.M{"$ifNull": bson.A{"$subtotal", "$total"}},
+				"discount": bson.M{"$ifNull": bson.A{"$discount", bson.M{"amount": 0, "currency": "$price.currency"}}},
+				"tax":      bson.M{"amount": 0, "currency": "$price.currency"},
+			}},
+			bson.M{"$unset": bson.A{"name", "quantity", "price"}},
+		})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated %d orders to line items", result.ModifiedCount)
+	}
+
+	cursor, err := MI.DB.Collection("orders").Find(ctx, bson.M{"number": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	numbered := 0
+	for cursor.Next(ctx) {
+		var order struct {
+			ID interface{} `bson:"_id"`
+		}
+		if err := cursor.Decode(&order); err != nil {
+			return err
+		}
+		number, err := NextOrderNumber(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := MI.DB.Collection("orders").UpdateByID(ctx, order.ID, bson.M{"$set": bson.M{"number": number}}); err != nil {
+			return err
+		}
+		numbered++
+	}
+	if numbered > 0 {
+		log.Printf("Numbered %d existing orders", numbered)
+	}
+	return cursor.Err()
+}
+
+// MigrateStatuses moves orders saved before the order lifecycle to
+// delivered and marks them migrated. Their stock was taken when they were
+// placed, so they are treated as done rather than as waiting for payment.
+// That covers orders without a status, or with one outside the lifecycle,
+// and pending orders an earlier version of this migration left without a
+// status history.
+func MigrateStatuses(ctx context.Context, statuses []string) error {
+	result, err := MI.DB.Collection("orders").UpdateMany(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"status": bson.M{"$nin": statuses}},
+			bson.M{"status": "pending", "status_history": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"status": "delivered", "migrated": true}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Set %d orders from before the order lifecycle to delivered", result.ModifiedCount)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InitOrders creates the indexes orders are looked up by
+func InitOrders(ctx context.Context) error {
+	_, err := MI.DB.Collection("orders").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"number": bson.M{"$type": "string"}})},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "items.name", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	return err
+}
+
+// NextSequence atomically increments and returns the named counter
+func NextSequence(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := MI.DB.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"value": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&counter)
+	return counter.Value, err
+}
+
+// NextOrderNumber returns a new human-friendly order number, e.g. ORD-000042
+func NextOrderNumber(ctx context.Context) (string, error) {
+	n, err := NextSequence(ctx, "order_number")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ORD-%06d", n), nil
+}
@@ -0,0 +1,114 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"order-service/cancellation"
+	"order-service/db"
+	"order-service/model"
+	"order-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Actor is recorded as the one who cancelled expired orders
+const Actor = "order-expiry"
+
+// lockKey is the Redis lock held by the replica running a sweep, so only one
+// replica expires orders at a time
+const lockKey = "lock:order-expiry"
+
+// lockTTL bounds how long a sweep holds the lock, in case its replica dies
+// before releasing it
+const lockTTL = 5 * time.Minute
+
+// stalled is how old an unfinished cancellation must be before a sweep
+// resumes it, leaving time for the request that started it to finish
+const stalled = time.Minute
+
+// Sweep cancels every order that has been pending for longer than window,
+// which puts its stock back and voids its payment, and resumes expiries that
+// stopped before they were done. It does nothing if another replica is
+// already sweeping.
+func Sweep(ctx context.Context, window time.Duration) {
+	token, ok, err := utils.TryLock(ctx, lockKey, lockTTL)
+	if err != nil {
+		log.Printf("Error taking the order expiry lock: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer func() {
+		if err := utils.Unlock(ctx, lockKey, token); err != nil {
+			log.Printf("Error releasing the order expiry lock: %v", err)
+		}
+	}()
+
+	// Order IDs start with the time the order was placed, and orders only
+	// ever leave pending, so this finds orders pending since before cutoff
+	cutoff := primitive.NewObjectIDFromTimestamp(time.Now().Add(-window))
+	reason := fmt.Sprintf("not paid within %s", window)
+	expire(ctx, bson.M{
+		"status":   model.StatusPending,
+		"_id":      bson.M{"$lt": cutoff},
+		"migrated": bson.M{"$ne": true},
+	}, reason)
+
+	expire(ctx, bson.M{
+		"status":                 model.StatusCancelled,
+		"cancellation.expired":   true,
+		"cancellation.completed": false,
+		"cancellation.at":        bson.M{"$lt": time.Now().UTC().Add(-stalled)},
+	}, reason)
+}
+
+func expire(ctx context.Context, filter bson.M, reason string) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := db.MI.DB.Collection("orders").Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error finding expired orders: %v", err)
+		return
+	}
+	var orders []model.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		log.Printf("Error finding expired orders: %v", err)
+		return
+	}
+
+	for _, found := range orders {
+		// Matched against filter again, so an order paid in the meantime is
+		// left alone
+		match := bson.M{"_id": found.ID}
+		for key, value := range filter {
+			if key != "_id" {
+				match[key] = value
+			}
+		}
+		order, err := cancellation.Expire(ctx, match, Actor, reason)
+		if order != nil {
+			utils.RDB.Del(ctx, "order:"+order.ID.Hex(), "order:"+order.Number)
+		}
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error expiring order %s: %v", found.ID.Hex(), err)
+			continue
+		}
+		log.Printf("Expired order %s", order.Number)
+	}
+}
+
+// Run sweeps for expired orders every interval
+func Run(interval, window time.Duration) {
+	for {
+		Sweep(context.TODO(), window)
+		time.Sleep(interval)
+	}
+}
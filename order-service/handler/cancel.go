@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"order-service/cancellation"
+	"order-service/lifecycle"
+	"order-service/utils"
+	"shared/auth"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CancelOrder cancels an order, by ID or order number, with a reason. Its
+// stock is put back and its payment voided or refunded. Users cancel their
+// own orders, admins any. Admins can force
+// the cancellation of orders past the cancellable statuses with "force".
+func CancelOrder(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+		Force  bool   `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Force && !auth.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can force a cancellation"})
+		return
+	}
+
+	cancelOrder(c, c.Param("id"), input.Reason, input.Force)
+}
+
+// cancelOrder cancels one of the caller's orders. Orders of other users are
+// not found, so their numbers aren't given away.
+func cancelOrder(c *gin.Context, id, reason string, force bool) {
+	filter, ok := ownOrderFilter(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	order, err := cancellation.Cancel(context.TODO(), filter, c.GetHeader("X-User-ID"), reason, force)
+	if order != nil {
+		invalidateOrder(order)
+	}
+	if err != nil {
+		var transitionErr *lifecycle.TransitionError
+		switch {
+		case err == mongo.ErrNoDocuments:
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		case errors.As(err, &transitionErr):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "order can't be cancelled from " + transitionErr.From,
+				"status":  transitionErr.From,
+				"allowed": transitionErr.Allowed,
+			})
+		case order != nil:
+			// Cancelled, but not fully undone. Cancelling again resumes.
+			log.Printf("Error completing cancellation of order %s: %v", order.Number, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "order cancelled, but undoing it failed, retry to resume", "order": order})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error cancelling order"})
+		}
+		return
+	}
+
+	utils.EmitEvents("order_exchange")
+
+	c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"order-service/cart"
+	"order-service/model"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cartRef picks the cart of the request: the user's cart when X-User-ID is
+// sent, otherwise the guest cart in X-Cart-ID
+func cartRef(c *gin.Context) cart.Ref {
+	return cart.Ref{UserID: c.GetHeader("X-User-ID"), GuestID: c.GetHeader("X-Cart-ID")}
+}
+
+func hasCart(ref cart.Ref) bool {
+	return ref.UserID != "" || ref.GuestID != ""
+}
+
+// GetCart retrieves the cart priced in the optional currency
+func GetCart(c *gin.Context) {
+	ref := cartRef(c)
+	if !hasCart(ref) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": cart.ErrNoCart.Error()})
+		return
+	}
+	respondCart(c, ref)
+}
+
+// AddToCart adds a quantity of a product to the cart. Requests without a
+// cart get a new guest cart, whose ID is returned in X-Cart-ID.
+func AddToCart(c *gin.Context) {
+	var input struct {
+		ProductName string `json:"name" binding:"required"`
+		Quantity    int    `json:"quantity" binding:"gt=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ref := cartRef(c)
+	if !hasCart(ref) {
+		ref = cart.NewGuest()
+	}
+
+	items, err := cart.Items(context.TODO(), ref)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching cart"})
+		return
+	}
+	if !checkStock(c, input.ProductName, items[input.ProductName]+input.Quantity) {
+		return
+	}
+	if _, err := cart.Add(context.TODO(), ref, input.ProductName, input.Quantity); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating cart"})
+		return
+	}
+	respondCart(c, ref)
+}
+
+// UpdateCartItem sets the quantity of a product in the cart, removing it at 0
+func UpdateCartItem(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Quantity int `json:"quantity" binding:"gte=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ref := cartRef(c)
+	if !hasCart(ref) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": cart.ErrNoCart.Error()})
+		return
+	}
+	if input.Quantity > 0 && !checkStock(c, productName, input.Quantity) {
+		return
+	}
+	if err := cart.Set(context.TODO(), ref, productName, input.Quantity); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating cart"})
+		return
+	}
+	respondCart(c, ref)
+}
+
+// RemoveCartItem takes a product out of the cart
+func RemoveCartItem(c *gin.Context) {
+	ref := cartRef(c)
+	if !hasCart(ref) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": cart.ErrNoCart.Error()})
+		return
+	}
+	if err := cart.Remove(context.TODO(), ref, c.Param("name")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating cart"})
+		return
+	}
+	respondCart(c, ref)
+}
+
+// MergeCart moves a guest cart into the cart of the user who just logged in
+func MergeCart(c *gin.Context) {
+	var input struct {
+		CartID string `json:"cart_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "merging a cart needs a logged-in user"})
+		return
+	}
+	if _, err := cart.Merge(context.TODO(), input.CartID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error merging carts"})
+		return
+	}
+	respondCart(c, cart.Ref{UserID: userID})
+}
+
+// Checkout places an order for everything in the cart and empties it. Prices
+// and stock are checked again when the order is placed.
+func Checkout(c *gin.Context) {
+	var input struct {
+		Currency   string `json:"currency"`
+		CouponCode string `json:"coupon_code"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ref := cartRef(c)
+	if !hasCart(ref) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": cart.ErrNoCart.Error()})
+		return
+	}
+	items, err := cart.Items(context.TODO(), ref)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching cart"})
+		return
+	}
+	if len(items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cart is empty"})
+		return
+	}
+
+	request := orderRequest{Currency: input.Currency, CouponCode: input.CouponCode}
+	for _, name := range sortedNames(items) {
+		request.Items = append(request.Items, orderItem{ProductName: name, Quantity: items[name]})
+	}
+	order, ok := placeOrder(c, request)
+	if !ok {
+		return
+	}
+	if err := cart.Clear(context.TODO(), ref); err != nil {
+		// The order stands, the cart is only left behind
+		c.Header("Warning", "199 - cart could not be emptied")
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// checkStock checks a product can be ordered in the quantity wanted
+func checkStock(c *gin.Context, productName string, quantity int) bool {
+	product, ok := fetchProduct(c, productName, "")
+	if !ok {
+		return false
+	}
+	if product.Quantity < quantity {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("only %d of %s in stock", product.Quantity, productName), "available": product.Quantity})
+		return false
+	}
+	return true
+}
+
+// respondCart answers with the cart priced with current prices and stock
+func respondCart(c *gin.Context, ref cart.Ref) {
+	items, err := cart.Items(context.TODO(), ref)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching cart"})
+		return
+	}
+
+	result := model.Cart{ID: ref.ID(), UserID: ref.UserID, Items: []model.CartItem{}, Currency: c.Query("currency")}
+	for _, name := range sortedNames(items) {
+		item := model.CartItem{ProductName: name, Quantity: items[name]}
+		product, _, err := getProduct(name, result.Currency)
+		switch {
+		case err != nil:
+			item.Error = err.Error()
+		case product.Quantity < item.Quantity:
+			item.Available = product.Quantity
+			item.UnitPrice = product.Price
+			item.Error = fmt.Sprintf("only %d in stock", product.Quantity)
+		default:
+			item.Available = product.Quantity
+			item.UnitPrice = product.Price
+			item.LineTotal = model.Money{Amount: product.Price.Amount * int64(item.Quantity), Currency: product.Price.Currency}
+			// Price the rest of the cart in the currency of the first product
+			result.Currency = product.Price.Currency
+			result.Subtotal.Currency = result.Currency
+			result.Subtotal.Amount += item.LineTotal.Amount
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	if ref.GuestID != "" && ref.UserID == "" {
+		c.Header("X-Cart-ID", ref.GuestID)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func sortedNames(items map[string]int) []string {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"order-service/coupon"
+	"order-service/db"
+	"order-service/model"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateCoupon stores a coupon. Codes are case-insensitive and unique.
+func CreateCoupon(c *gin.Context) {
+	var cp model.Coupon
+	if err := c.ShouldBindJSON(&cp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cp.Code = coupon.NormalizeCode(cp.Code)
+	if cp.Amount != nil {
+		cp.Amount.Currency = strings.ToUpper(cp.Amount.Currency)
+	}
+	if cp.MinOrderValue != nil {
+		cp.MinOrderValue.Currency = strings.ToUpper(cp.MinOrderValue.Currency)
+	}
+	if err := coupon.Validate(&cp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cp.ID = primitive.NewObjectID()
+	cp.Redemptions = 0
+	cp.CreatedAt = time.Now().UTC()
+
+	if _, err := db.MI.DB.Collection("coupons").InsertOne(context.TODO(), cp); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "coupon code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating coupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, cp)
+}
+
+// GetCoupons lists every coupon with its redemption count, newest first
+func GetCoupons(c *gin.Context) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.MI.DB.Collection("coupons").Find(context.TODO(), bson.M{}, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching coupons"})
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	coupons := []model.Coupon{}
+	if err := cursor.All(context.TODO(), &coupons); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+// GetCoupon retrieves a coupon by code
+func GetCoupon(c *gin.Context) {
+	var cp model.Coupon
+	err := db.MI.DB.Collection("coupons").FindOne(context.TODO(), bson.M{"code": coupon.NormalizeCode(c.Param("code"))}).Decode(&cp)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cp)
+}
+
+// DeleteCoupon removes a coupon so it can no longer be redeemed
+func DeleteCoupon(c *gin.Context) {
+	code := coupon.NormalizeCode(c.Param("code"))
+	result, err := db.MI.DB.Collection("coupons").DeleteOne(context.TODO(), bson.M{"code": code})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting coupon"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "coupon deleted"})
+}
@@ -3,114 +3,316 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"order-service/coupon"
 	"order-service/db"
+	"order-service/lifecycle"
 	"order-service/model"
+	"order-service/payment"
+	"order-service/promotion"
+	"order-service/saga"
 	"order-service/utils" // Ensure this path is correct relative to your project structure
+	"shared/auth"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// CreateOrder handles the creation of a new order
+// orderRequest is the body of POST /order. The user placing the order is
+// always the X-User-ID the gateway sends, never one from the body.
+type orderRequest struct {
+	Currency   string      `json:"currency"`
+	CouponCode string      `json:"coupon_code"`
+	Items      []orderItem `json:"items" binding:"required,min=1,dive"`
+}
+
+type orderItem struct {
+	ProductName string `json:"name" binding:"required"`
+	Quantity    int    `json:"quantity" binding:"gt=0"`
+}
+
+// CreateOrder handles the creation of a new order. Prices, discounts, tax
+// and totals are worked out here from the product service, whatever the
+// client sends.
 func CreateOrder(c *gin.Context) {
-	var order model.Order
-	// Bind JSON data to order struct
-	if err := c.BindJSON(&order); err != nil {
+	var request orderRequest
+	// Bind JSON data to the order request
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	// Step 1: Check the product inventory via HTTP request to the product service
-	productResp, err := http.Get(fmt.Sprintf("http://localhost:8082/product/%s", order.ProductName))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error sending request to product service: %v", err)})
-		return
+	if order, ok := placeOrder(c, request); ok {
+		// Return the created order response
+		c.JSON(http.StatusCreated, order)
 	}
-	defer productResp.Body.Close()
-	if productResp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
-		return
+}
+
+// placeOrder prices and places an order. It writes the error response and
+// returns false when the order can't be placed.
+func placeOrder(c *gin.Context, request orderRequest) (*model.Order, bool) {
+	order := model.Order{
+		UserID:     c.GetHeader("X-User-ID"),
+		Currency:   request.Currency,
+		CouponCode: request.CouponCode,
+		Status:     model.StatusPending,
 	}
+	order.History = []model.StatusChange{lifecycle.Started(c.GetHeader("X-User-ID"))}
 
-	// Decode the product details
-	var product model.Product
-	if err := json.NewDecoder(productResp.Body).Decode(&product); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error decoding product response: %v", err)})
-		return
+	// Step 1: Check the inventory and price of every product via the product
+	// service, in the currency the customer pays in. Without one, the
+	// currency of the first product is used for the rest.
+	quantities := make(map[string]int)
+	var names []string
+	for _, item := range request.Items {
+		if _, ok := quantities[item.ProductName]; !ok {
+			names = append(names, item.ProductName)
+		}
+		quantities[item.ProductName] += item.Quantity
 	}
+	var lines []promotion.Line
+	for _, name := range names {
+		product, ok := fetchProduct(c, name, order.Currency)
+		if !ok {
+			return nil, false
+		}
+		// Check if enough inventory is available
+		quantity := quantities[name]
+		if product.Quantity < quantity {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("insufficient inventory for %s", name)})
+			return nil, false
+		}
+		order.Currency = product.Price.Currency
 
-	// Check if enough inventory is available
-	if product.Quantity < order.Quantity {
-		c.JSON(http.StatusConflict, gin.H{"error": "insufficient inventory"})
-		return
+		order.Items = append(order.Items, model.LineItem{
+			ProductID:   product.ID,
+			ProductName: product.ProductName,
+			SKU:         product.SKU,
+			Quantity:    quantity,
+			UnitPrice:   product.Price,
+			LineTotal:   model.Money{Amount: product.Price.Amount * int64(quantity), Currency: product.Price.Currency},
+		})
+		lines = append(lines, promotion.Line{
+			ProductName: product.ProductName,
+			Category:    product.Category,
+			Quantity:    quantity,
+			UnitPrice:   product.Price,
+		})
 	}
 
 	// Set additional order fields
 	order.CreatedAt = time.Now().Format(time.RFC3339)
-	order.Price = product.Price // Use the product's price
+	order.Subtotal = model.Money{Currency: order.Currency}
+	for _, item := range order.Items {
+		order.Subtotal.Amount += item.LineTotal.Amount
+	}
 
-	// Save the new order to your MongoDB database
-	insertResult, err := db.MI.DB.Collection("orders").InsertOne(context.TODO(), order)
+	// Apply the running promotions and keep a record of each for auditing
+	promotions, err := promotion.Active(context.TODO(), time.Now())
 	if err != nil {
-		log.Printf("Error creating order: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error creating order: %v", err)})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error fetching promotions: %v", err)})
+		return nil, false
 	}
-	log.Printf("Inserted a single document: %v", insertResult.InsertedID)
+	order.Discount, order.Promotions = promotion.Evaluate(promotions, lines)
+	order.Total = model.Money{Amount: order.Subtotal.Amount - order.Discount.Amount, Currency: order.Currency}
 
-	// Emit an event to RabbitMQ
-	event := map[string]interface{}{
-		"product_name": order.ProductName,
-		"quantity":     order.Quantity,
+	// A coupon comes off the total after promotions. Its redemption is
+	// taken now and given back if the order can't be placed.
+	var redeemed *model.Coupon
+	if order.CouponCode != "" {
+		redeemed, err = coupon.Find(context.TODO(), order.CouponCode)
+		if err != nil {
+			couponError(c, err)
+			return nil, false
+		}
+		discount, err := coupon.Discount(redeemed, order.Total)
+		if err != nil {
+			couponError(c, err)
+			return nil, false
+		}
+		if err := coupon.Redeem(context.TODO(), redeemed, order.UserID); err != nil {
+			couponError(c, err)
+			return nil, false
+		}
+		order.Coupon = &model.AppliedCoupon{Code: redeemed.Code, Discount: discount}
+		order.Discount.Amount += discount.Amount
+		order.Total.Amount -= discount.Amount
+	}
+	releaseCoupon := func() {
+		if redeemed != nil {
+			if err := coupon.Release(context.TODO(), redeemed, order.UserID); err != nil {
+				log.Printf("Error releasing coupon %s: %v", redeemed.Code, err)
+			}
+		}
 	}
-	eventJSON, err := json.Marshal(event)
+
+	// Tax is charged on the discounted total
+	order.Tax = model.Money{
+		Amount:   int64(math.Round(float64(order.Total.Amount) * utils.TaxRate() / 100)),
+		Currency: order.Currency,
+	}
+	order.Total.Amount += order.Tax.Amount
+
+	order.ID = primitive.NewObjectID()
+	order.Number, err = db.NextOrderNumber(context.TODO())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error marshaling event: %v", eventJSON)})
-		return
+		releaseCoupon()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error numbering order: %v", err)})
+		return nil, false
+	}
+
+	// Place the order through its saga: reserve the stock, authorize the
+	// payment and confirm the order, undoing what was done if a step fails
+	placed, err := saga.Place(context.TODO(), order)
+	if err != nil {
+		if placed == nil {
+			releaseCoupon()
+			log.Printf("Error creating order: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error creating order: %v", err)})
+			return nil, false
+		}
+		switch {
+		case errors.Is(err, utils.ErrInsufficientInventory):
+			c.JSON(http.StatusConflict, gin.H{"error": "insufficient inventory", "saga": placed})
+		case errors.Is(err, utils.ErrProductArchived):
+			c.JSON(http.StatusGone, gin.H{"error": "a product of the order is no longer available", "saga": placed})
+		case errors.Is(err, payment.ErrDeclined):
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "saga": placed})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error placing order: %v", err), "saga": placed})
+		}
+		return nil, false
 	}
 	utils.EmitEvents("Order Created")
+	return &order, true
+}
+
+// fetchProduct gets a product from the product service priced in the given
+// currency, or in its own when currency is empty. It writes the error
+// response when the product can't be ordered.
+func fetchProduct(c *gin.Context, productName, currency string) (*model.Product, bool) {
+	product, status, err := getProduct(productName, currency)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error emitting event: %v", err)})
-		return
+		c.JSON(status, gin.H{"error": err.Error()})
+		return nil, false
 	}
+	return product, true
+}
 
-	// Update the product inventory
-	err = utils.UpdateProductInventory(order.ProductName, -order.Quantity)
+// getProduct gets a product that can be ordered from the product service,
+// or the error and the status to answer it with
+func getProduct(productName, currency string) (*model.Product, int, error) {
+	productURL := fmt.Sprintf("http://localhost:8082/product/%s", url.PathEscape(productName))
+	if currency != "" {
+		productURL += "?currency=" + url.QueryEscape(currency)
+	}
+	productResp, err := http.Get(productURL)
 	if err != nil {
-		log.Printf("Error updating product inventory: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error updating product inventory: %v", err)})
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("error sending request to product service: %v", err)
+	}
+	defer productResp.Body.Close()
+	if productResp.StatusCode == http.StatusBadRequest {
+		return nil, http.StatusBadRequest, errors.New("unsupported currency")
+	}
+	if productResp.StatusCode != http.StatusOK {
+		return nil, http.StatusNotFound, fmt.Errorf("product %s not found", productName)
+	}
+
+	// Decode the product details
+	var product model.Product
+	if err := json.NewDecoder(productResp.Body).Decode(&product); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("error decoding product response: %v", err)
 	}
 
-	utils.EmitEvents("Order_created")
+	// Archived products stay readable for past orders but can't be ordered
+	if product.DeletedAt != nil {
+		return nil, http.StatusGone, fmt.Errorf("product %s is no longer available", productName)
+	}
+	return &product, http.StatusOK, nil
+}
+
+func couponError(c *gin.Context, err error) {
+	switch err {
+	case coupon.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case coupon.ErrExpired, coupon.ErrLimitReached, coupon.ErrUserLimitReached:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case coupon.ErrUserRequired:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case coupon.ErrMinimumNotMet, coupon.ErrCurrency:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("error redeeming coupon: %v", err)})
+	}
+}
+
+// orderFilter matches an order by its ID or its order number
+func orderFilter(id string) bson.M {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": oid}
+	}
+	return bson.M{"number": id}
+}
+
+// ownOrderFilter matches an order by its ID or its order number among the
+// orders the caller may act on: their own, or any for an admin or another
+// service. Anonymous callers have none.
+func ownOrderFilter(c *gin.Context, id string) (bson.M, bool) {
+	filter := orderFilter(id)
+	if auth.IsAdmin(c) || auth.IsService(c) {
+		return filter, true
+	}
+	userID := c.GetHeader(auth.UserHeader)
+	if userID == "" {
+		return nil, false
+	}
+	filter["user_id"] = userID
+	return filter, true
+}
 
-	// Return the created order response
-	c.JSON(http.StatusCreated, order)
+// ownsOrder reports whether the caller may see an order already loaded, like
+// one from the cache
+func ownsOrder(c *gin.Context, order *model.Order) bool {
+	if auth.IsAdmin(c) || auth.IsService(c) {
+		return true
+	}
+	userID := c.GetHeader(auth.UserHeader)
+	return userID != "" && userID == order.UserID
 }
 
-// GetOrder retrieves an order by product name
+// GetOrder retrieves an order by ID or order number. Users only see their
+// own orders; other orders are not found.
 func GetOrder(c *gin.Context) {
-	productName := c.Param("productName")
+	id := c.Param("id")
 	var order model.Order
 
 	// Check Redis cache first
-	val, err := utils.RDB.Get(context.Background(), "order:"+productName).Result()
+	val, err := utils.RDB.Get(context.Background(), "order:"+id).Result()
 	if err == nil {
 		// Cache hit
 		log.Println("Cache hit")
 		if err := json.Unmarshal([]byte(val), &order); err == nil {
+			if !ownsOrder(c, &order) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+				return
+			}
 			c.JSON(http.StatusOK, order)
 			return
 		}
 	}
 
 	// Cache miss, query the database
-	err = db.MI.DB.Collection("orders").FindOne(context.TODO(), bson.M{"productName": productName}).Decode(&order)
+	err = db.MI.DB.Collection("orders").FindOne(context.TODO(), orderFilter(id)).Decode(&order)
+	if err == nil && !ownsOrder(c, &order) {
+		err = mongo.ErrNoDocuments
+	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
@@ -123,7 +325,7 @@ func GetOrder(c *gin.Context) {
 	// Store result in Redis cache
 	data, err := json.Marshal(order)
 	if err == nil {
-		err = utils.RDB.Set(context.Background(), "order:"+productName, data, 5*time.Minute).Err()
+		err = utils.RDB.Set(context.Background(), "order:"+id, data, 5*time.Minute).Err()
 		if err != nil {
 			log.Printf("Error setting cache: %v", err)
 		}
@@ -132,44 +334,134 @@ func GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
-// UpdateStatus updates the status of an order by product name
+// GetOrderSaga retrieves the placement saga of an order by ID or order
+// number, including orders whose placement failed
+func GetOrderSaga(c *gin.Context) {
+	id := c.Param("id")
+	filter := bson.M{"order_number": id}
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		filter = bson.M{"_id": oid}
+	}
+
+	placed, err := saga.Find(context.TODO(), filter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "saga not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching saga"})
+		return
+	}
+
+	c.JSON(http.StatusOK, placed)
+}
+
+// invalidateOrder evicts an order from the cache under both its keys
+func invalidateOrder(order *model.Order) {
+	keys := []string{"order:" + order.ID.Hex()}
+	if order.Number != "" {
+		keys = append(keys, "order:"+order.Number)
+	}
+	if err := utils.RDB.Del(context.Background(), keys...).Err(); err != nil {
+		log.Printf("Error evicting order %s from cache: %v", order.ID.Hex(), err)
+	}
+}
+
+// UpdateStatus moves an order, by ID or order number, to a new status of
+// its lifecycle. Moves the lifecycle doesn't allow get a 409 listing the
+// statuses the order can move to. Only admins and other services fulfil
+// orders; users can only cancel their own.
 func UpdateStatus(c *gin.Context) {
-	productName := c.Param("name")
-	var order model.Order
+	id := c.Param("id")
+	var input struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
+	}
 
-	// Bind JSON data to order struct
-	if err := c.BindJSON(&order); err != nil {
+	// Bind JSON data to the status update
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if the order status can be updated
-	if order.Status == "pending" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order Already Shipped"})
+	// Orders are only paid or refunded by moving money, through the payment
+	// capture and refunds
+	switch input.Status {
+	case model.StatusPaid:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "orders are paid by capturing their payment with POST /order/:id/payment/capture"})
+		return
+	case model.StatusRefunded:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "orders are refunded by refunding their payment, through cancellation or returns"})
 		return
 	}
 
-	// Create a filter to find the order by product name
-	filter := bson.M{"productName": productName}
-	update := bson.M{"$set": bson.M{"status": order.Status}}
+	// Cancelling also undoes the order, so it goes through the same path as
+	// POST /order/:id/cancel
+	if input.Status == model.StatusCancelled {
+		cancelOrder(c, id, input.Note, false)
+		return
+	}
 
-	// Update the order status
-	_, err := db.MI.DB.Collection("orders").UpdateOne(context.TODO(), filter, update)
+	if !auth.IsAdmin(c) && !auth.IsService(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can fulfil orders"})
+		return
+	}
+
+	order, err := lifecycle.Transition(context.TODO(), orderFilter(id), input.Status, c.GetHeader("X-User-ID"), input.Note)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating order status"})
+		var transitionErr *lifecycle.TransitionError
+		switch {
+		case err == mongo.ErrNoDocuments:
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		case err == lifecycle.ErrUnknownStatus:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.As(err, &transitionErr):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   err.Error(),
+				"status":  transitionErr.From,
+				"allowed": transitionErr.Allowed,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating order status"})
+		}
 		return
 	}
+	invalidateOrder(order)
 
 	utils.EmitEvents("order_exchange")
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
+	c.JSON(http.StatusOK, order)
 }
 
+// GetOrders lists orders, optionally filtered by user_id and by a product
+// name appearing in the order. Users only list their own orders; admins and
+// other services can list anyone's.
 func GetOrders(c *gin.Context) {
 	var orders []model.Order
 
+	filter := bson.M{}
+	userID := c.Query("user_id")
+	if !auth.IsAdmin(c) && !auth.IsService(c) {
+		caller := c.GetHeader(auth.UserHeader)
+		if caller == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "log in to list your orders"})
+			return
+		}
+		if userID != "" && userID != caller {
+			c.JSON(http.StatusForbidden, gin.H{"error": "users can only list their own orders"})
+			return
+		}
+		userID = caller
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	if name := c.Query("name"); name != "" {
+		filter["items.name"] = name
+	}
+
 	// Query the database
-	cursor, err := db.MI.DB.Collection("orders").Find(context.Background(), bson.D{})
+	cursor, err := db.MI.DB.Collection("orders").Find(context.Background(), filter)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error fetching orders"})
 		return
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"order-service/db"
+	"order-service/lifecycle"
+	"order-service/model"
+	"order-service/payment"
+	"order-service/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orderID resolves an order ID or order number to the ID of an order the
+// caller may see, writing the error response when it can't
+func orderID(c *gin.Context, id string) (string, bool) {
+	filter, ok := ownOrderFilter(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return "", false
+	}
+	var order model.Order
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	err := db.MI.DB.Collection("orders").FindOne(context.TODO(), filter, opts).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching order"})
+		return "", false
+	}
+	return order.ID.Hex(), true
+}
+
+// GetOrderPayment retrieves the payment of an order, by ID or order number,
+// with its transactions
+func GetOrderPayment(c *gin.Context) {
+	id, ok := orderID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	intent, err := payment.Find(context.TODO(), id)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching payment"})
+		return
+	}
+	transactions, err := payment.Transactions(context.TODO(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching payment transactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payment": intent, "transactions": transactions})
+}
+
+// CapturePayment captures the authorized payment of an order, which moves
+// the order to paid
+func CapturePayment(c *gin.Context) {
+	id, ok := orderID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	intent, order, err := payment.Capture(context.TODO(), id, c.GetHeader("X-User-ID"))
+	var transitionErr *lifecycle.TransitionError
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	case err == payment.ErrAlreadyCaptured || err == payment.ErrNotAuthorized:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "payment": intent})
+		return
+	case errors.As(err, &transitionErr):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": transitionErr.From, "payment": intent})
+		return
+	case err == payment.ErrOrderCancelled:
+		invalidateOrder(order)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": order.Status})
+		return
+	case err == payment.ErrDeclined:
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "payment": intent})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error capturing payment"})
+		return
+	}
+	invalidateOrder(order)
+
+	utils.EmitEvents("order_exchange")
+
+	c.JSON(http.StatusOK, gin.H{"payment": intent, "order": order})
+}
+
+// PaymentWebhook receives the provider's notifications about payments. Only
+// webhooks with a valid, recent signature are accepted.
+func PaymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error reading webhook"})
+		return
+	}
+	if err := payment.Verify(payment.WebhookSecret, c.GetHeader(payment.SignatureHeader), body, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var event model.PaymentWebhook
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook"})
+		return
+	}
+
+	order, err := payment.HandleWebhook(context.TODO(), event)
+	if err == payment.ErrOrderCancelled {
+		invalidateOrder(order)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": order.Status})
+		return
+	}
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "payment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error handling webhook"})
+		return
+	}
+	if order != nil {
+		invalidateOrder(order)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"order-service/db"
+	"order-service/model"
+	"order-service/promotion"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreatePromotion stores a promotion. It starts now unless starts_at is given.
+func CreatePromotion(c *gin.Context) {
+	var p model.Promotion
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if p.StartsAt.IsZero() {
+		p.StartsAt = time.Now()
+	}
+	p.StartsAt = p.StartsAt.UTC()
+	if p.Amount != nil {
+		p.Amount.Currency = strings.ToUpper(p.Amount.Currency)
+	}
+	if err := promotion.Validate(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.ID = primitive.NewObjectID()
+	p.CreatedAt = time.Now().UTC()
+
+	if _, err := db.MI.DB.Collection("promotions").InsertOne(context.TODO(), p); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating promotion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// GetPromotions lists every promotion, or only the running ones with active=true
+func GetPromotions(c *gin.Context) {
+	var promotions []model.Promotion
+	var err error
+	if c.Query("active") == "true" {
+		promotions, err = promotion.Active(context.TODO(), time.Now())
+	} else {
+		promotions, err = promotion.All(context.TODO())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching promotions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+// DeletePromotion removes a promotion. Orders keep the record of what it took off.
+func DeletePromotion(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid promotion id"})
+		return
+	}
+
+	result, err := db.MI.DB.Collection("promotions").DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting promotion"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "promotion not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "promotion deleted"})
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"order-service/db"
+	"order-service/model"
+	"order-service/payment"
+	"order-service/returns"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// returnFilter matches a return by ID or RMA number
+func returnFilter(id string) bson.M {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return bson.M{"_id": oid}
+	}
+	return bson.M{"number": id}
+}
+
+// respondReturnError writes the response for an error of the returns package
+func respondReturnError(c *gin.Context, err error) {
+	var itemErr *returns.ItemError
+	var statusErr *returns.StatusError
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "return not found"})
+	case err == returns.ErrNotReturnable, err == returns.ErrRefundInProcess:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &itemErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "name": itemErr.ProductName})
+	case errors.As(err, &statusErr):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": statusErr.From})
+	case err == payment.ErrInvalidAmount, err == payment.ErrRefundTooLarge, err == payment.ErrNotCaptured:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing return"})
+	}
+}
+
+// RequestReturn opens a return for line items of a delivered order, each
+// with a quantity and a reason. Users can only return their own orders.
+func RequestReturn(c *gin.Context) {
+	var input struct {
+		Items []struct {
+			ProductName string `json:"name" binding:"required"`
+			Quantity    int    `json:"quantity" binding:"gt=0"`
+			Reason      string `json:"reason" binding:"required"`
+		} `json:"items" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, ok := ownOrderFilter(c, c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	var order model.Order
+	if err := db.MI.DB.Collection("orders").FindOne(context.TODO(), filter).Decode(&order); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching order"})
+		return
+	}
+
+	items := make([]model.ReturnItem, 0, len(input.Items))
+	for _, item := range input.Items {
+		items = append(items, model.ReturnItem{ProductName: item.ProductName, Quantity: item.Quantity, Reason: item.Reason})
+	}
+	r, err := returns.Request(context.TODO(), &order, c.GetHeader("X-User-ID"), items)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// GetOrderReturns lists the returns of an order, by ID or order number
+func GetOrderReturns(c *gin.Context) {
+	id, ok := orderID(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	list, err := returns.List(context.TODO(), bson.M{"order_id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching returns"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetReturns lists every return, optionally only those in a status
+func GetReturns(c *gin.Context) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	list, err := returns.List(context.TODO(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching returns"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetReturn retrieves a return by ID or RMA number
+func GetReturn(c *gin.Context) {
+	r, err := returns.Find(context.TODO(), returnFilter(c.Param("id")))
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// ApproveReturn accepts a requested return
+func ApproveReturn(c *gin.Context) {
+	var input struct {
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r, err := returns.Approve(context.TODO(), returnFilter(c.Param("id")), c.GetHeader("X-User-ID"), input.Note)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// RejectReturn turns down a requested return, with a note saying why
+func RejectReturn(c *gin.Context) {
+	var input struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r, err := returns.Reject(context.TODO(), returnFilter(c.Param("id")), c.GetHeader("X-User-ID"), input.Note)
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// ReceiveReturn confirms the items of an approved return arrived, which puts
+// them back in stock
+func ReceiveReturn(c *gin.Context) {
+	r, err := returns.Receive(context.TODO(), returnFilter(c.Param("id")), c.GetHeader("X-User-ID"))
+	if err != nil {
+		if r != nil {
+			// Received, but not all of it restocked. Receiving again resumes.
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "return received, but restocking failed, retry to resume", "return": r})
+			return
+		}
+		respondReturnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// RefundReturn refunds a received return, by default the returned items'
+// share of the order total, or the "amount" given
+func RefundReturn(c *gin.Context) {
+	var input struct {
+		Amount *model.Money `json:"amount"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	r, err := returns.Refund(context.TODO(), returnFilter(c.Param("id")), c.GetHeader("X-User-ID"), input.Amount)
+	if r != nil {
+		oid, _ := primitive.ObjectIDFromHex(r.OrderID)
+		invalidateOrder(&model.Order{ID: oid, Number: r.OrderNumber})
+	}
+	if err != nil {
+		respondReturnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,167 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-service/db"
+	"order-service/model"
+	"order-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// transitions lists the statuses an order can move to from each status.
+// Cancelled and refunded orders are final.
+var transitions = map[string][]string{
+	model.StatusPending:    {model.StatusPaid, model.StatusCancelled},
+	model.StatusPaid:       {model.StatusFulfilling, model.StatusCancelled, model.StatusRefunded},
+	model.StatusFulfilling: {model.StatusShipped, model.StatusCancelled},
+	model.StatusShipped:    {model.StatusDelivered},
+	model.StatusDelivered:  {model.StatusRefunded},
+	model.StatusCancelled:  {},
+	model.StatusRefunded:   {},
+}
+
+var events = map[string]string{
+	model.StatusPaid:       model.EventOrderPaid,
+	model.StatusFulfilling: model.EventOrderFulfilling,
+	model.StatusShipped:    model.EventOrderShipped,
+	model.StatusDelivered:  model.EventOrderDelivered,
+	model.StatusCancelled:  model.EventOrderCancelled,
+	model.StatusRefunded:   model.EventOrderRefunded,
+}
+
+var ErrUnknownStatus = errors.New("unknown order status")
+
+// TransitionError is returned for a move the lifecycle doesn't allow
+type TransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order can't move from %s to %s", e.From, e.To)
+}
+
+// Statuses returns every status of the lifecycle
+func Statuses() []string {
+	statuses := make([]string, 0, len(transitions))
+	for status := range transitions {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Valid reports whether status is part of the lifecycle
+func Valid(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// Allowed returns the statuses an order in status can move to
+func Allowed(status string) []string {
+	return transitions[status]
+}
+
+func allowed(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Started returns the first status history entry of a new order
+func Started(actor string) model.StatusChange {
+	return model.StatusChange{Status: model.StatusPending, Actor: actor, At: time.Now().UTC()}
+}
+
+// Change is a status change applied with Apply
+type Change struct {
+	Status string
+	Actor  string
+	Note   string
+	// Force allows a move the lifecycle doesn't, from any status that isn't
+	// final. The change is recorded as an override.
+	Force bool
+	// Set holds other fields of the order to update with the status
+	Set bson.M
+	// Stage, if set, stages more events for the changed order in the same
+	// transaction
+	Stage func(ctx context.Context, order *model.Order) error
+}
+
+// Transition moves the order matching filter to status, records the change
+// in its history and publishes the status event. The update only applies if
+// the order is still in the status it was read in, so two concurrent moves
+// can't both succeed.
+func Transition(ctx context.Context, filter bson.M, status, actor, note string) (*model.Order, error) {
+	return Apply(ctx, filter, Change{Status: status, Actor: actor, Note: note})
+}
+
+// Apply makes a status change like Transition
+func Apply(ctx context.Context, filter bson.M, c Change) (*model.Order, error) {
+	if !Valid(c.Status) {
+		return nil, ErrUnknownStatus
+	}
+
+	var current model.Order
+	if err := db.MI.DB.Collection("orders").FindOne(ctx, filter).Decode(&current); err != nil {
+		return nil, err
+	}
+	override := false
+	if !allowed(current.Status, c.Status) {
+		if !c.Force || len(Allowed(current.Status)) == 0 || current.Status == c.Status {
+			return nil, &TransitionError{From: current.Status, To: c.Status, Allowed: Allowed(current.Status)}
+		}
+		override = true
+	}
+
+	change := model.StatusChange{From: current.Status, Status: c.Status, Actor: c.Actor, Note: c.Note, Override: override, At: time.Now().UTC()}
+	set := bson.M{"status": c.Status}
+	for field, value := range c.Set {
+		set[field] = value
+	}
+	var order model.Order
+	err := utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		err := db.MI.DB.Collection("orders").FindOneAndUpdate(ctx,
+			bson.M{"_id": current.ID, "status": current.Status},
+			bson.M{
+				"$set":  set,
+				"$push": bson.M{"status_history": change},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+		if err != nil {
+			return err
+		}
+		err = utils.StageEvent(ctx, events[c.Status], model.OrderStatusEvent{
+			OrderID:  order.ID.Hex(),
+			Number:   order.Number,
+			UserID:   order.UserID,
+			From:     change.From,
+			Status:   c.Status,
+			Note:     c.Note,
+			Override: override,
+			At:       change.At,
+		})
+		if err != nil || c.Stage == nil {
+			return err
+		}
+		return c.Stage(ctx, &order)
+	})
+	if err == mongo.ErrNoDocuments {
+		// Someone else moved the order first, try again against its new
+		// status, if it still matches filter
+		return Apply(ctx, filter, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
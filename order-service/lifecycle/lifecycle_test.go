@@ -0,0 +1,146 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"order-service/db"
+	"order-service/model"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{model.StatusPending, model.StatusPaid, true},
+		{model.StatusPending, model.StatusCancelled, true},
+		{model.StatusPending, model.StatusFulfilling, false},
+		{model.StatusPending, model.StatusShipped, false},
+		{model.StatusPending, model.StatusRefunded, false},
+		{model.StatusPaid, model.StatusFulfilling, true},
+		{model.StatusPaid, model.StatusCancelled, true},
+		{model.StatusPaid, model.StatusRefunded, true},
+		{model.StatusPaid, model.StatusPending, false},
+		{model.StatusPaid, model.StatusShipped, false},
+		{model.StatusFulfilling, model.StatusShipped, true},
+		{model.StatusFulfilling, model.StatusCancelled, true},
+		{model.StatusFulfilling, model.StatusDelivered, false},
+		{model.StatusShipped, model.StatusDelivered, true},
+		{model.StatusShipped, model.StatusCancelled, false},
+		{model.StatusDelivered, model.StatusRefunded, true},
+		{model.StatusDelivered, model.StatusCancelled, false},
+		{model.StatusCancelled, model.StatusPending, false},
+		{model.StatusCancelled, model.StatusPaid, false},
+		{model.StatusRefunded, model.StatusPaid, false},
+		{model.StatusPending, model.StatusPending, false},
+		{"unknown", model.StatusPaid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := allowed(tt.from, tt.to); got != tt.want {
+				t.Errorf("allowed(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitionTable(t *testing.T) {
+	for from, next := range transitions {
+		for _, to := range next {
+			if !Valid(to) {
+				t.Errorf("%s moves to unknown status %s", from, to)
+			}
+			if events[to] == "" {
+				t.Errorf("moving to %s publishes no event", to)
+			}
+		}
+	}
+	for _, final := range []string{model.StatusCancelled, model.StatusRefunded} {
+		if len(Allowed(final)) != 0 {
+			t.Errorf("%s is final but allows %v", final, Allowed(final))
+		}
+	}
+	if Valid("lost") {
+		t.Error(`Valid("lost") = true`)
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	tests := []struct {
+		name    string
+		current string
+		change  Change
+		wantErr error
+		// wantAllowed is checked for transition errors
+		wantAllowed []string
+	}{
+		{
+			name:    "unknown status",
+			change:  Change{Status: "lost"},
+			wantErr: ErrUnknownStatus,
+		},
+		{
+			name:        "move the lifecycle doesn't allow",
+			current:     model.StatusShipped,
+			change:      Change{Status: model.StatusCancelled},
+			wantAllowed: []string{model.StatusDelivered},
+		},
+		{
+			name:        "backwards",
+			current:     model.StatusPaid,
+			change:      Change{Status: model.StatusPending},
+			wantAllowed: []string{model.StatusFulfilling, model.StatusCancelled, model.StatusRefunded},
+		},
+		{
+			name:        "force out of a final status",
+			current:     model.StatusCancelled,
+			change:      Change{Status: model.StatusPaid, Force: true},
+			wantAllowed: []string{},
+		},
+		{
+			name:        "force to the same status",
+			current:     model.StatusDelivered,
+			change:      Change{Status: model.StatusDelivered, Force: true},
+			wantAllowed: []string{model.StatusRefunded},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			db.MI.DB = mt.DB
+			if tt.current != "" {
+				order := bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "status", Value: tt.current}}
+				mt.AddMockResponses(mtest.CreateCursorResponse(0, "orders.orders", mtest.FirstBatch, order))
+			}
+
+			order, err := Apply(context.Background(), bson.M{}, tt.change)
+			if order != nil {
+				mt.Errorf("order = %+v, want none", order)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					mt.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) {
+				mt.Fatalf("error = %v, want a TransitionError", err)
+			}
+			if transitionErr.From != tt.current || transitionErr.To != tt.change.Status {
+				mt.Errorf("error = %v, want %s to %s", err, tt.current, tt.change.Status)
+			}
+			if !reflect.DeepEqual(transitionErr.Allowed, tt.wantAllowed) {
+				mt.Errorf("allowed = %v, want %v", transitionErr.Allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
 	"log"
+	"order-service/cart"
+	"order-service/coupon"
 	"order-service/db"
+	"order-service/expiry"
 	"order-service/handler"
+	"order-service/lifecycle"
 	"order-service/metrics"
 	"order-service/middleware"
+	"order-service/payment"
+	"order-service/returns"
+	"order-service/saga"
 	"order-service/utils"
+	"os"
+	"shared/auth"
+	"shared/idempotency"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func main() {
@@ -18,18 +32,148 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error connecting to database: %v", err)
 	}
+	base := utils.BaseCurrency()
+	if err = db.MigrateMoney(context.TODO(), base, utils.MinorUnit(base)); err != nil {
+		log.Fatalf("Error migrating order prices: %v", err)
+	}
+	if err = db.MigrateLineItems(context.TODO()); err != nil {
+		log.Fatalf("Error migrating orders to line items: %v", err)
+	}
+	if err = db.MigrateStatuses(context.TODO(), lifecycle.Statuses()); err != nil {
+		log.Fatalf("Error migrating order statuses: %v", err)
+	}
+	if err = db.InitOrders(context.TODO()); err != nil {
+		log.Fatalf("Error creating order indexes: %v", err)
+	}
+	if err = coupon.Init(); err != nil {
+		log.Fatalf("Error initialising coupons: %v", err)
+	}
+	if err = saga.Init(); err != nil {
+		log.Fatalf("Error initialising sagas: %v", err)
+	}
+	if err = returns.Init(); err != nil {
+		log.Fatalf("Error initialising returns: %v", err)
+	}
+	if err = payment.Init(); err != nil {
+		log.Fatalf("Error initialising payments: %v", err)
+	}
+
+	// Payments go through the fake provider, which signs its webhooks with
+	// the same secret the webhook endpoint checks
+	payment.WebhookSecret = os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if payment.WebhookSecret == "" {
+		payment.WebhookSecret = primitive.NewObjectID().Hex()
+		log.Println("PAYMENT_WEBHOOK_SECRET not set, using a random secret")
+	}
+	var paymentLimit int64
+	if v := os.Getenv("FAKE_PAYMENT_LIMIT"); v != "" {
+		if paymentLimit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Fatal("invalid FAKE_PAYMENT_LIMIT: ", err)
+		}
+	}
+	webhookURL := "http://localhost:8083/payments/webhook"
+	if v, ok := os.LookupEnv("FAKE_PAYMENT_WEBHOOK_URL"); ok {
+		webhookURL = v
+	}
+	payment.Default = payment.NewFake(paymentLimit, webhookURL)
 	metrics.Init()
 	utils.InitRedis()
 	utils.InitMQ()
 	defer utils.CloseMQ()
 
+	// Relay events from the outbox to RabbitMQ
+	outboxInterval := time.Second
+	if v := os.Getenv("OUTBOX_INTERVAL"); v != "" {
+		if outboxInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid OUTBOX_INTERVAL: ", err)
+		}
+	}
+	if err = utils.InitOutbox(db.MI.DB, outboxInterval); err != nil {
+		log.Fatalf("Error initialising the outbox: %v", err)
+	}
+
+	// Resume order placements interrupted by a crash
+	recoveryInterval := 30 * time.Second
+	if v := os.Getenv("SAGA_RECOVERY_INTERVAL"); v != "" {
+		if recoveryInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid SAGA_RECOVERY_INTERVAL: ", err)
+		}
+	}
+	go saga.RunRecovery(recoveryInterval)
+
+	// Cancel orders left unpaid for longer than the expiry window
+	expiryWindow := 30 * time.Minute
+	if v := os.Getenv("ORDER_EXPIRY_WINDOW"); v != "" {
+		if expiryWindow, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid ORDER_EXPIRY_WINDOW: ", err)
+		}
+	}
+	expiryInterval := time.Minute
+	if v := os.Getenv("ORDER_EXPIRY_INTERVAL"); v != "" {
+		if expiryInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid ORDER_EXPIRY_INTERVAL: ", err)
+		}
+	}
+	if expiryWindow > 0 {
+		go expiry.Run(expiryInterval, expiryWindow)
+	}
+
+	if v := os.Getenv("CART_GUEST_TTL"); v != "" {
+		if cart.GuestTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid CART_GUEST_TTL: ", err)
+		}
+	}
+
+	// Key of the tokens the user service signs, shared by every service. The
+	// inventory calls to the product service carry tokens signed with it too.
+	secret, err := auth.Secret()
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.AuthSecret = secret
+
+	// Responses kept for retries sent with an Idempotency-Key
+	idempotencyTTL := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		if idempotencyTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid IDEMPOTENCY_TTL: ", err)
+		}
+	}
+
 	router := gin.Default()
 	router.Use(middleware.PrometheusMiddleware())
+	router.Use(auth.Middleware(secret))
 	router.GET("/metrics", metrics.PrometheusHandler)
 	router.GET("/orders", handler.GetOrders)
-	router.POST("/order", handler.CreateOrder)
+	router.POST("/order", idempotency.Middleware(utils.RDB, idempotencyTTL), handler.CreateOrder)
 	router.GET("/order/:id", handler.GetOrder)
 	router.PUT("/order/:id", handler.UpdateStatus)
+	router.POST("/order/:id/cancel", handler.CancelOrder)
+	router.GET("/order/:id/saga", handler.GetOrderSaga)
+	router.GET("/order/:id/payment", handler.GetOrderPayment)
+	router.POST("/order/:id/payment/capture", auth.RequireAdmin(), handler.CapturePayment)
+	router.POST("/payments/webhook", handler.PaymentWebhook)
+	router.POST("/order/:id/returns", handler.RequestReturn)
+	router.GET("/order/:id/returns", handler.GetOrderReturns)
+	router.GET("/returns", auth.RequireAdmin(), handler.GetReturns)
+	router.GET("/return/:id", handler.GetReturn)
+	router.POST("/return/:id/approve", auth.RequireAdmin(), handler.ApproveReturn)
+	router.POST("/return/:id/reject", auth.RequireAdmin(), handler.RejectReturn)
+	router.POST("/return/:id/receive", auth.RequireAdmin(), handler.ReceiveReturn)
+	router.POST("/return/:id/refund", auth.RequireAdmin(), handler.RefundReturn)
+	router.GET("/cart", handler.GetCart)
+	router.POST("/cart/items", handler.AddToCart)
+	router.PUT("/cart/items/:name", handler.UpdateCartItem)
+	router.DELETE("/cart/items/:name", handler.RemoveCartItem)
+	router.POST("/cart/merge", handler.MergeCart)
+	router.POST("/cart/checkout", idempotency.Middleware(utils.RDB, idempotencyTTL), handler.Checkout)
+	router.GET("/promotions", handler.GetPromotions)
+	router.POST("/promotion", auth.RequireAdmin(), handler.CreatePromotion)
+	router.DELETE("/promotion/:id", auth.RequireAdmin(), handler.DeletePromotion)
+	router.GET("/coupons", auth.RequireAdmin(), handler.GetCoupons)
+	router.POST("/coupon", auth.RequireAdmin(), handler.CreateCoupon)
+	router.GET("/coupon/:code", auth.RequireAdmin(), handler.GetCoupon)
+	router.DELETE("/coupon/:code", auth.RequireAdmin(), handler.DeleteCoupon)
 
 	router.Run(":8083")
 }
@@ -0,0 +1,21 @@
+package model
+
+// Cart is a cart priced with the current prices and stock of its products
+type Cart struct {
+	ID       string     `json:"id"`
+	UserID   string     `json:"user_id,omitempty"`
+	Items    []CartItem `json:"items"`
+	Currency string     `json:"currency,omitempty"`
+	Subtotal Money      `json:"subtotal"`
+}
+
+// CartItem is a product in a cart. Items that can't be bought as they are
+// say why in Error and are left out of the subtotal.
+type CartItem struct {
+	ProductName string `json:"name"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unit_price"`
+	LineTotal   Money  `json:"line_total"`
+	Available   int    `json:"available"`
+	Error       string `json:"error,omitempty"`
+}
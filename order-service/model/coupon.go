@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Coupon types
+const (
+	CouponPercentage = "percentage"
+	CouponFixed      = "fixed"
+)
+
+// Coupon is a code customers redeem on an order for a discount. A limit of
+// 0 means unlimited.
+type Coupon struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code           string             `json:"code" bson:"code" binding:"required"`
+	Type           string             `json:"type" bson:"type" binding:"required,oneof=percentage fixed"`
+	Percent        float64            `json:"percent,omitempty" bson:"percent,omitempty"`
+	Amount         *Money             `json:"amount,omitempty" bson:"amount,omitempty"`
+	MinOrderValue  *Money             `json:"min_order_value,omitempty" bson:"min_order_value,omitempty"`
+	MaxRedemptions int                `json:"max_redemptions" bson:"max_redemptions" binding:"gte=0"`
+	MaxPerUser     int                `json:"max_per_user" bson:"max_per_user" binding:"gte=0"`
+	Redemptions    int                `json:"redemptions" bson:"redemptions"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// AppliedCoupon records the coupon redeemed on an order
+type AppliedCoupon struct {
+	Code     string `json:"code" bson:"code"`
+	Discount Money  `json:"discount" bson:"discount"`
+}
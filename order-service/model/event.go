@@ -0,0 +1,97 @@
+package model
+
+import "time"
+
+const EventOrderCreated = "order.created"
+
+// OrderCreatedEvent is published once an order has been saved and its stock
+// reserved
+type OrderCreatedEvent struct {
+	OrderID string      `json:"order_id"`
+	UserID  string      `json:"user_id,omitempty"`
+	Items   []EventItem `json:"items"`
+	Total   Money       `json:"total"`
+}
+
+// EventItem is a product and quantity of an order in an event
+type EventItem struct {
+	ProductName string `json:"name"`
+	Quantity    int    `json:"quantity"`
+}
+
+// Events published when an order moves to a status, one per status
+const (
+	EventOrderPaid       = "order.paid"
+	EventOrderFulfilling = "order.fulfilling"
+	EventOrderShipped    = "order.shipped"
+	EventOrderDelivered  = "order.delivered"
+	EventOrderCancelled  = "order.cancelled"
+	EventOrderRefunded   = "order.refunded"
+)
+
+// EventOrderExpired is published, with order.cancelled, for an order
+// cancelled because it stayed pending too long
+const EventOrderExpired = "order.expired"
+
+// OrderExpiredEvent is published when a pending order expires
+type OrderExpiredEvent struct {
+	OrderID   string      `json:"order_id"`
+	Number    string      `json:"number"`
+	UserID    string      `json:"user_id,omitempty"`
+	Items     []EventItem `json:"items"`
+	PlacedAt  time.Time   `json:"placed_at"`
+	ExpiredAt time.Time   `json:"expired_at"`
+}
+
+// OrderStatusEvent is published whenever an order changes status. Note is
+// the reason given for the move, such as why the order was cancelled.
+type OrderStatusEvent struct {
+	OrderID  string    `json:"order_id"`
+	Number   string    `json:"number"`
+	UserID   string    `json:"user_id,omitempty"`
+	From     string    `json:"from"`
+	Status   string    `json:"status"`
+	Note     string    `json:"note,omitempty"`
+	Override bool      `json:"override,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Events published for each operation on the payment of an order
+const (
+	EventPaymentAuthorized = "payment.authorized"
+	EventPaymentCaptured   = "payment.captured"
+	EventPaymentVoided     = "payment.voided"
+	EventPaymentRefunded   = "payment.refunded"
+)
+
+// PaymentEvent is published when a payment transaction is recorded
+type PaymentEvent struct {
+	OrderID     string `json:"order_id"`
+	IntentID    string `json:"intent_id"`
+	Status      string `json:"status"`
+	Amount      Money  `json:"amount"`
+	ProviderRef string `json:"provider_ref"`
+}
+
+// Events published at each step of a return
+const (
+	EventReturnRequested = "return.requested"
+	EventReturnApproved  = "return.approved"
+	EventReturnRejected  = "return.rejected"
+	EventReturnReceived  = "return.received"
+	EventReturnRefunded  = "return.refunded"
+)
+
+// ReturnEvent is published whenever a return changes status
+type ReturnEvent struct {
+	ReturnID    string       `json:"return_id"`
+	Number      string       `json:"number"`
+	OrderID     string       `json:"order_id"`
+	OrderNumber string       `json:"order_number"`
+	UserID      string       `json:"user_id,omitempty"`
+	Status      string       `json:"status"`
+	Items       []ReturnItem `json:"items"`
+	Refund      *Money       `json:"refund,omitempty"`
+	Note        string       `json:"note,omitempty"`
+	At          time.Time    `json:"at"`
+}
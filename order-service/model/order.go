@@ -1,9 +1,57 @@
 package model
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Order is a placed order. Migrated is set on orders placed before the
+// order lifecycle.
 type Order struct {
-	ProductName string  `json:"name" bson:"name"`
-	Quantity    int     `json:"quantity" bson:"quantity"`
-	Price       float64 `json:"price" bson:"price"`
-	Status      string  `json:"status" bson:"status"`
-	CreatedAt   string  `json:"created_at" bson:"created_at"`
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Number       string             `json:"number" bson:"number"`
+	UserID       string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Items        []LineItem         `json:"items" bson:"items"`
+	Currency     string             `json:"currency,omitempty" bson:"-"`
+	Subtotal     Money              `json:"subtotal" bson:"subtotal"`
+	Discount     Money              `json:"discount" bson:"discount"`
+	Tax          Money              `json:"tax" bson:"tax"`
+	Total        Money              `json:"total" bson:"total"`
+	Refunded     *Money             `json:"refunded,omitempty" bson:"refunded,omitempty"`
+	Promotions   []AppliedPromotion `json:"promotions,omitempty" bson:"promotions,omitempty"`
+	CouponCode   string             `json:"coupon_code,omitempty" bson:"-"`
+	Coupon       *AppliedCoupon     `json:"coupon,omitempty" bson:"coupon,omitempty"`
+	Status       string             `json:"status" bson:"status"`
+	History      []StatusChange     `json:"status_history,omitempty" bson:"status_history,omitempty"`
+	Cancellation *Cancellation      `json:"cancellation,omitempty" bson:"cancellation,omitempty"`
+	Migrated     bool               `json:"migrated,omitempty" bson:"migrated,omitempty"`
+	CreatedAt    string             `json:"created_at" bson:"created_at"`
+}
+
+// LineItem is one product of an order, priced when the order was placed.
+// Returned counts the units asked back by returns that weren't rejected.
+type LineItem struct {
+	ProductID   string `json:"product_id" bson:"product_id"`
+	ProductName string `json:"name" bson:"name"`
+	SKU         string `json:"sku,omitempty" bson:"sku,omitempty"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+	UnitPrice   Money  `json:"unit_price" bson:"unit_price"`
+	LineTotal   Money  `json:"line_total" bson:"line_total"`
+	Returned    int    `json:"returned,omitempty" bson:"returned,omitempty"`
+}
+
+// Cancellation records why and by whom an order was cancelled, and how far
+// undoing it got: the line items put back in stock, what happened to the
+// payment (voided, refunded or none) and whether the coupon was given back
+type Cancellation struct {
+	Reason         string    `json:"reason" bson:"reason"`
+	Actor          string    `json:"actor,omitempty" bson:"actor,omitempty"`
+	Forced         bool      `json:"forced,omitempty" bson:"forced,omitempty"`
+	Expired        bool      `json:"expired,omitempty" bson:"expired,omitempty"`
+	Restocked      []string  `json:"restocked,omitempty" bson:"restocked,omitempty"`
+	Payment        string    `json:"payment,omitempty" bson:"payment,omitempty"`
+	CouponReleased bool      `json:"coupon_released,omitempty" bson:"coupon_released,omitempty"`
+	Completed      bool      `json:"completed" bson:"completed"`
+	At             time.Time `json:"at" bson:"at"`
 }
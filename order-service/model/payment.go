@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment intent statuses
+const (
+	PaymentAuthorized        = "authorized"
+	PaymentCaptured          = "captured"
+	PaymentVoided            = "voided"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// Payment transaction types
+const (
+	TransactionAuthorize = "authorize"
+	TransactionCapture   = "capture"
+	TransactionVoid      = "void"
+	TransactionRefund    = "refund"
+)
+
+// PaymentIntent is the payment of an order with a provider, from
+// authorization to capture and any refunds
+type PaymentIntent struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	OrderID         string             `json:"order_id" bson:"order_id"`
+	Provider        string             `json:"provider" bson:"provider"`
+	Status          string             `json:"status" bson:"status"`
+	Amount          Money              `json:"amount" bson:"amount"`
+	Captured        Money              `json:"captured" bson:"captured"`
+	Refunded        Money              `json:"refunded" bson:"refunded"`
+	AuthorizationID string             `json:"authorization_id" bson:"authorization_id"`
+	CaptureID       string             `json:"capture_id,omitempty" bson:"capture_id,omitempty"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// PaymentTransaction is one operation on a payment intent. Refunds carry
+// the reference they were asked for with, such as the return they are for.
+type PaymentTransaction struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	IntentID    primitive.ObjectID `json:"intent_id" bson:"intent_id"`
+	OrderID     string             `json:"order_id" bson:"order_id"`
+	Type        string             `json:"type" bson:"type"`
+	Amount      Money              `json:"amount" bson:"amount"`
+	ProviderRef string             `json:"provider_ref" bson:"provider_ref"`
+	Reference   string             `json:"reference,omitempty" bson:"reference,omitempty"`
+	Source      string             `json:"source" bson:"source"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// PaymentWebhook is a notification from a payment provider about an
+// operation on an authorization
+type PaymentWebhook struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	AuthorizationID string    `json:"authorization_id"`
+	ProviderRef     string    `json:"provider_ref"`
+	Amount          Money     `json:"amount"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Payment webhook types
+const (
+	WebhookCaptured = "authorization.captured"
+	WebhookVoided   = "authorization.voided"
+	WebhookRefunded = "authorization.refunded"
+)
@@ -1,9 +1,14 @@
 package model
 
+import "time"
+
 type Product struct {
-	ID          string  `json:"id" bson:"_id,omitempty"`
-	ProductName string  `json:"name" bson:"name"`
-	Description string  `json:"description" bson:"description"`
-	Price       float64 `json:"price" bson:"price"`
-	Quantity    int     `json:"quantity" bson:"quantity"`
+	ID          string     `json:"id" bson:"_id,omitempty"`
+	ProductName string     `json:"name" bson:"name"`
+	SKU         string     `json:"sku,omitempty" bson:"sku,omitempty"`
+	Description string     `json:"description" bson:"description"`
+	Category    string     `json:"category" bson:"category"`
+	Price       Money      `json:"price" bson:"price"`
+	Quantity    int        `json:"quantity" bson:"quantity"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 }
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Promotion types
+const (
+	PromotionPercentage = "percentage"
+	PromotionFixed      = "fixed"
+	PromotionBuyXGetY   = "buy_x_get_y"
+	PromotionTiered     = "tiered"
+)
+
+// Promotion is a discount applied automatically to orders of the products or
+// categories it targets, or to the whole order when it targets neither.
+// Promotions are evaluated by descending priority; a promotion that is not
+// stackable only applies when no other promotion has, and stops evaluation.
+type Promotion struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name" binding:"required"`
+	Type        string             `json:"type" bson:"type" binding:"required,oneof=percentage fixed buy_x_get_y tiered"`
+	Percent     float64            `json:"percent,omitempty" bson:"percent,omitempty"`
+	Amount      *Money             `json:"amount,omitempty" bson:"amount,omitempty"`
+	BuyQuantity int                `json:"buy_quantity,omitempty" bson:"buy_quantity,omitempty"`
+	GetQuantity int                `json:"get_quantity,omitempty" bson:"get_quantity,omitempty"`
+	Tiers       []PromotionTier    `json:"tiers,omitempty" bson:"tiers,omitempty"`
+	Products    []string           `json:"products,omitempty" bson:"products,omitempty"`
+	Categories  []string           `json:"categories,omitempty" bson:"categories,omitempty"`
+	StartsAt    time.Time          `json:"starts_at" bson:"starts_at"`
+	EndsAt      *time.Time         `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	Priority    int                `json:"priority" bson:"priority"`
+	Stackable   bool               `json:"stackable" bson:"stackable"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// PromotionTier takes Percent off once MinQuantity units are bought
+type PromotionTier struct {
+	MinQuantity int     `json:"min_quantity" bson:"min_quantity"`
+	Percent     float64 `json:"percent" bson:"percent"`
+}
+
+// AppliedPromotion records what a promotion took off an order
+type AppliedPromotion struct {
+	PromotionID primitive.ObjectID `json:"promotion_id" bson:"promotion_id"`
+	Name        string             `json:"name" bson:"name"`
+	Type        string             `json:"type" bson:"type"`
+	Discount    Money              `json:"discount" bson:"discount"`
+}
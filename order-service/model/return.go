@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Return statuses. A requested return is approved or rejected by staff, an
+// approved one is received back into stock and then refunded.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunded  = "refunded"
+)
+
+// Return is a return merchandise authorization (RMA) for line items of a
+// delivered order
+type Return struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	Number      string             `json:"number" bson:"number"`
+	OrderID     string             `json:"order_id" bson:"order_id"`
+	OrderNumber string             `json:"order_number" bson:"order_number"`
+	UserID      string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Items       []ReturnItem       `json:"items" bson:"items"`
+	Status      string             `json:"status" bson:"status"`
+	History     []StatusChange     `json:"status_history" bson:"status_history"`
+	// Restocked lists the items put back in stock once received
+	Restocked []string  `json:"restocked,omitempty" bson:"restocked,omitempty"`
+	Refund    *Money    `json:"refund,omitempty" bson:"refund,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// ReturnItem is a quantity of a line item sent back, and why
+type ReturnItem struct {
+	ProductName string `json:"name" bson:"name"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+	Reason      string `json:"reason" bson:"reason"`
+	UnitPrice   Money  `json:"unit_price" bson:"unit_price"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Saga statuses
+const (
+	SagaRunning      = "running"
+	SagaCompleted    = "completed"
+	SagaCompensating = "compensating"
+	SagaFailed       = "failed"
+)
+
+// Saga step statuses
+const (
+	StepPending     = "pending"
+	StepRunning     = "running"
+	StepDone        = "done"
+	StepFailed      = "failed"
+	StepCompensated = "compensated"
+)
+
+// Saga tracks the placement of an order through its steps. It shares its ID
+// with the order it places.
+type Saga struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	OrderNumber     string             `json:"order_number" bson:"order_number"`
+	Status          string             `json:"status" bson:"status"`
+	Steps           []SagaStep         `json:"steps" bson:"steps"`
+	Reserved        []string           `json:"reserved,omitempty" bson:"reserved,omitempty"`
+	AuthorizationID string             `json:"authorization_id,omitempty" bson:"authorization_id,omitempty"`
+	Error           string             `json:"error,omitempty" bson:"error,omitempty"`
+	Order           Order              `json:"-" bson:"order"`
+	LockedUntil     time.Time          `json:"-" bson:"locked_until"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// SagaStep is the progress of one step of a saga
+type SagaStep struct {
+	Name       string     `json:"name" bson:"name"`
+	Status     string     `json:"status" bson:"status"`
+	Error      string     `json:"error,omitempty" bson:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Order statuses
+const (
+	StatusPending    = "pending"
+	StatusPaid       = "paid"
+	StatusFulfilling = "fulfilling"
+	StatusShipped    = "shipped"
+	StatusDelivered  = "delivered"
+	StatusCancelled  = "cancelled"
+	StatusRefunded   = "refunded"
+)
+
+// StatusChange is one entry of an order's status history. Override is set
+// on moves an admin forced past the lifecycle.
+type StatusChange struct {
+	From     string    `json:"from,omitempty" bson:"from,omitempty"`
+	Status   string    `json:"status" bson:"status"`
+	Actor    string    `json:"actor,omitempty" bson:"actor,omitempty"`
+	Note     string    `json:"note,omitempty" bson:"note,omitempty"`
+	Override bool      `json:"override,omitempty" bson:"override,omitempty"`
+	At       time.Time `json:"at" bson:"at"`
+}
@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"order-service/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fake is an in-memory provider for local development. It authorizes every
+// amount up to its limit (no limit when 0) and declines the rest. When given
+// a webhook URL, it reports captures, voids and refunds to it with signed
+// webhooks, like a real provider would.
+type Fake struct {
+	limit      int64
+	webhookURL string
+
+	mu             sync.Mutex
+	authorizations map[string]*fakeAuthorization
+	references     map[string]string
+}
+
+type fakeAuthorization struct {
+	amount   model.Money
+	captured int64
+	refunded int64
+	voided   bool
+	refunds  map[string]string
+}
+
+func NewFake(limit int64, webhookURL string) *Fake {
+	return &Fake{
+		limit:          limit,
+		webhookURL:     webhookURL,
+		authorizations: make(map[string]*fakeAuthorization),
+		references:     make(map[string]string),
+	}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Authorize(ctx context.Context, reference string, amount model.Money) (string, error) {
+	if f.limit > 0 && amount.Amount > f.limit {
+		return "", ErrDeclined
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id, ok := f.references[reference]; ok && !f.authorizations[id].voided {
+		return id, nil
+	}
+	id := "fake_auth_" + primitive.NewObjectID().Hex()
+	f.authorizations[id] = &fakeAuthorization{amount: amount, refunds: make(map[string]string)}
+	f.references[reference] = id
+	return id, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, authorizationID string, amount model.Money) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, ok := f.authorizations[authorizationID]
+	switch {
+	case !ok || auth.voided:
+		return "", ErrNotAuthorized
+	case auth.captured > 0:
+		return "", ErrAlreadyCaptured
+	case amount.Amount > auth.amount.Amount:
+		return "", ErrDeclined
+	}
+	auth.captured = amount.Amount
+	ref := "fake_capture_" + primitive.NewObjectID().Hex()
+	f.notify(model.WebhookCaptured, authorizationID, ref, amount)
+	return ref, nil
+}
+
+func (f *Fake) Void(ctx context.Context, authorizationID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, ok := f.authorizations[authorizationID]
+	switch {
+	case !ok:
+		return ErrNotAuthorized
+	case auth.captured > 0:
+		return ErrAlreadyCaptured
+	}
+	if !auth.voided {
+		auth.voided = true
+		f.notify(model.WebhookVoided, authorizationID, authorizationID, auth.amount)
+	}
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, authorizationID string, amount model.Money, reference string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, ok := f.authorizations[authorizationID]
+	if ok && auth.refunds[reference] != "" {
+		return auth.refunds[reference], nil
+	}
+	switch {
+	case !ok:
+		return "", ErrNotAuthorized
+	case auth.captured == 0:
+		return "", ErrNotCaptured
+	case auth.refunded+amount.Amount > auth.captured:
+		return "", ErrRefundTooLarge
+	}
+	auth.refunded += amount.Amount
+	ref := "fake_refund_" + primitive.NewObjectID().Hex()
+	auth.refunds[reference] = ref
+	f.notify(model.WebhookRefunded, authorizationID, ref, amount)
+	return ref, nil
+}
+
+// notify posts a signed webhook in the background
+func (f *Fake) notify(eventType, authorizationID, ref string, amount model.Money) {
+	if f.webhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(model.PaymentWebhook{
+		ID:              "fake_evt_" + primitive.NewObjectID().Hex(),
+		Type:            eventType,
+		AuthorizationID: authorizationID,
+		ProviderRef:     ref,
+		Amount:          amount,
+		CreatedAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("Error encoding fake webhook: %v", err)
+		return
+	}
+	go func() {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req, err := http.NewRequest(http.MethodPost, f.webhookURL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Error creating fake webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SignatureHeader, Sign(WebhookSecret, timestamp, body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("Error sending fake webhook: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
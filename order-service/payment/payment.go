@@ -0,0 +1,362 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"order-service/db"
+	"order-service/lifecycle"
+	"order-service/model"
+	"order-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CancellationRefund is the reference of the refund of whatever is left of
+// the payment of a cancelled order, shared by everything that cancels it
+func CancellationRefund(orderID string) string {
+	return "cancellation:" + orderID
+}
+
+var (
+	ErrInvalidAmount  = errors.New("amount must be positive")
+	ErrOrderCancelled = errors.New("order was cancelled before the payment was captured, the payment was refunded")
+)
+
+var transactionEvents = map[string]string{
+	model.TransactionAuthorize: model.EventPaymentAuthorized,
+	model.TransactionCapture:   model.EventPaymentCaptured,
+	model.TransactionVoid:      model.EventPaymentVoided,
+	model.TransactionRefund:    model.EventPaymentRefunded,
+}
+
+// Transaction sources
+const (
+	sourceAPI     = "api"
+	sourceWebhook = "webhook"
+)
+
+// Init creates the indexes payments are looked up by. A provider operation
+// is recorded once however many times it's reported, so transactions are
+// unique by type and provider reference.
+func Init() error {
+	indexes := map[string]mongo.IndexModel{
+		"payment_intents":      {Keys: bson.D{{Key: "order_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		"payment_transactions": {Keys: bson.D{{Key: "type", Value: 1}, {Key: "provider_ref", Value: 1}}, Options: options.Index().SetUnique(true)},
+	}
+	for collection, indexModel := range indexes {
+		if _, err := db.MI.DB.Collection(collection).Indexes().CreateOne(context.TODO(), indexModel); err != nil {
+			return err
+		}
+	}
+	_, err := db.MI.DB.Collection("payment_intents").Indexes().CreateOne(context.TODO(),
+		mongo.IndexModel{Keys: bson.D{{Key: "authorization_id", Value: 1}}})
+	return err
+}
+
+// Find returns the payment intent of an order
+func Find(ctx context.Context, orderID string) (*model.PaymentIntent, error) {
+	var intent model.PaymentIntent
+	err := db.MI.DB.Collection("payment_intents").FindOne(ctx, bson.M{"order_id": orderID}).Decode(&intent)
+	if err != nil {
+		return nil, err
+	}
+	return &intent, nil
+}
+
+// Transactions returns the transactions of an order's payment, oldest first
+func Transactions(ctx context.Context, orderID string) ([]model.PaymentTransaction, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := db.MI.DB.Collection("payment_transactions").Find(ctx, bson.M{"order_id": orderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []model.PaymentTransaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// Authorize holds amount for an order with the provider and records the
+// order's payment intent. Retrying it for the same order returns the same
+// authorization.
+func Authorize(ctx context.Context, orderID string, amount model.Money) (*model.PaymentIntent, error) {
+	id, err := Default.Authorize(ctx, orderID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	zero := model.Money{Currency: amount.Currency}
+	var intent model.PaymentIntent
+	err = db.MI.DB.Collection("payment_intents").FindOneAndUpdate(ctx,
+		bson.M{"order_id": orderID},
+		bson.M{"$setOnInsert": model.PaymentIntent{
+			ID:              primitive.NewObjectID(),
+			OrderID:         orderID,
+			Provider:        Default.Name(),
+			Status:          model.PaymentAuthorized,
+			Amount:          amount,
+			Captured:        zero,
+			Refunded:        zero,
+			AuthorizationID: id,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&intent)
+	if err != nil {
+		return nil, err
+	}
+
+	return record(ctx, &intent, model.TransactionAuthorize, amount, id, sourceAPI, nil, nil)
+}
+
+// Capture takes the authorized amount of the payment of a pending order and
+// moves the order to paid. It returns the updated intent and order.
+func Capture(ctx context.Context, orderID, actor string) (*model.PaymentIntent, *model.Order, error) {
+	intent, err := Find(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch intent.Status {
+	case model.PaymentAuthorized:
+	case model.PaymentVoided:
+		return intent, nil, ErrNotAuthorized
+	default:
+		return intent, nil, ErrAlreadyCaptured
+	}
+
+	// Only orders still waiting for payment can be paid
+	var order model.Order
+	oid, _ := primitive.ObjectIDFromHex(orderID)
+	if err := db.MI.DB.Collection("orders").FindOne(ctx, bson.M{"_id": oid}).Decode(&order); err != nil {
+		return intent, nil, err
+	}
+	if order.Status != model.StatusPending {
+		return intent, nil, &lifecycle.TransitionError{From: order.Status, To: model.StatusPaid, Allowed: lifecycle.Allowed(order.Status)}
+	}
+
+	ref, err := Default.Capture(ctx, intent.AuthorizationID, intent.Amount)
+	if err != nil {
+		return intent, nil, err
+	}
+	if intent, err = captured(ctx, intent, ref, intent.Amount, sourceAPI); err != nil {
+		return nil, nil, err
+	}
+	if intent.Status == model.PaymentVoided {
+		return intent, nil, ErrNotAuthorized
+	}
+	paid, err := markPaid(ctx, intent, actor)
+	return intent, paid, err
+}
+
+// Void releases the authorization of an order's payment. Voiding an already
+// voided payment does nothing.
+func Void(ctx context.Context, orderID string) (*model.PaymentIntent, error) {
+	intent, err := Find(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	switch intent.Status {
+	case model.PaymentVoided:
+		return intent, nil
+	case model.PaymentAuthorized:
+	default:
+		return intent, ErrAlreadyCaptured
+	}
+
+	if err := Default.Void(ctx, intent.AuthorizationID); err != nil {
+		return intent, err
+	}
+	return voided(ctx, intent, sourceAPI)
+}
+
+// Refund gives back amount of the captured payment of an order. Reference
+// identifies the refund: retrying a refund with the same reference, after a
+// crash or a lost response, returns the intent without refunding twice.
+func Refund(ctx context.Context, orderID string, amount model.Money, reference string) (*model.PaymentIntent, error) {
+	intent, err := Find(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.MI.DB.Collection("payment_transactions").FindOne(ctx, bson.M{
+		"order_id":  orderID,
+		"type":      model.TransactionRefund,
+		"reference": reference,
+	}).Err()
+	if err == nil {
+		return intent, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	if amount.Amount <= 0 {
+		return intent, ErrInvalidAmount
+	}
+	switch intent.Status {
+	case model.PaymentCaptured, model.PaymentPartiallyRefunded:
+	default:
+		return intent, ErrNotCaptured
+	}
+	if intent.Refunded.Amount+amount.Amount > intent.Captured.Amount {
+		return intent, ErrRefundTooLarge
+	}
+
+	ref, err := Default.Refund(ctx, intent.AuthorizationID, amount, reference)
+	if err != nil {
+		return intent, err
+	}
+	if intent, err = refunded(ctx, intent, ref, amount, sourceAPI); err != nil {
+		return nil, err
+	}
+	// Set even when a webhook recorded the refund first
+	_, err = db.MI.DB.Collection("payment_transactions").UpdateOne(ctx,
+		bson.M{"type": model.TransactionRefund, "provider_ref": ref},
+		bson.M{"$set": bson.M{"reference": reference}})
+	return intent, err
+}
+
+// captured records the capture of an authorized intent
+func captured(ctx context.Context, intent *model.PaymentIntent, ref string, amount model.Money, source string) (*model.PaymentIntent, error) {
+	return record(ctx, intent, model.TransactionCapture, amount, ref, source, []string{model.PaymentAuthorized}, bson.M{"$set": bson.M{
+		"status":     model.PaymentCaptured,
+		"captured":   amount,
+		"capture_id": ref,
+		"updated_at": time.Now().UTC(),
+	}})
+}
+
+// voided records the void of an authorized intent
+func voided(ctx context.Context, intent *model.PaymentIntent, source string) (*model.PaymentIntent, error) {
+	return record(ctx, intent, model.TransactionVoid, intent.Amount, intent.AuthorizationID, source, []string{model.PaymentAuthorized}, bson.M{"$set": bson.M{
+		"status":     model.PaymentVoided,
+		"updated_at": time.Now().UTC(),
+	}})
+}
+
+// refunded adds a refund to the intent, which is fully refunded once all
+// of the captured amount has been given back
+func refunded(ctx context.Context, intent *model.PaymentIntent, ref string, amount model.Money, source string) (*model.PaymentIntent, error) {
+	return record(ctx, intent, model.TransactionRefund, amount, ref, source, []string{model.PaymentCaptured, model.PaymentPartiallyRefunded}, bson.A{
+		bson.M{"$set": bson.M{
+			"refunded.amount": bson.M{"$add": bson.A{"$refunded.amount", amount.Amount}},
+			"updated_at":      time.Now().UTC(),
+		}},
+		bson.M{"$set": bson.M{"status": bson.M{"$cond": bson.A{
+			bson.M{"$gte": bson.A{"$refunded.amount", "$captured.amount"}},
+			model.PaymentRefunded,
+			model.PaymentPartiallyRefunded,
+		}}}},
+	})
+}
+
+// record saves a transaction of an intent, applies update to the intent,
+// adds refunds to the order's refunded amount and publishes the payment
+// event, in one transaction. The update only applies to an intent in one of
+// the from statuses. An operation already recorded, because both the API
+// and a webhook reported it, or one that no longer applies to the intent,
+// such as a capture reported after a refund, is skipped and the intent
+// returned as it is.
+func record(ctx context.Context, intent *model.PaymentIntent, kind string, amount model.Money, ref, source string, from []string, update interface{}) (*model.PaymentIntent, error) {
+	var updated model.PaymentIntent
+	err := utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		_, err := db.MI.DB.Collection("payment_transactions").InsertOne(ctx, model.PaymentTransaction{
+			ID:          primitive.NewObjectID(),
+			IntentID:    intent.ID,
+			OrderID:     intent.OrderID,
+			Type:        kind,
+			Amount:      amount,
+			ProviderRef: ref,
+			Source:      source,
+			CreatedAt:   time.Now().UTC(),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return db.MI.DB.Collection("payment_intents").FindOne(ctx, bson.M{"_id": intent.ID}).Decode(&updated)
+		}
+		if err != nil {
+			return err
+		}
+
+		if update == nil {
+			updated = *intent
+		} else {
+			filter := bson.M{"_id": intent.ID, "status": bson.M{"$in": from}}
+			err = db.MI.DB.Collection("payment_intents").FindOneAndUpdate(ctx, filter, update,
+				options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+			if err == mongo.ErrNoDocuments {
+				if _, err := db.MI.DB.Collection("payment_transactions").DeleteOne(ctx, bson.M{"type": kind, "provider_ref": ref}); err != nil {
+					return err
+				}
+				return db.MI.DB.Collection("payment_intents").FindOne(ctx, bson.M{"_id": intent.ID}).Decode(&updated)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if kind == model.TransactionRefund {
+			// The order shows how much of its total was given back
+			oid, _ := primitive.ObjectIDFromHex(updated.OrderID)
+			_, err := db.MI.DB.Collection("orders").UpdateOne(ctx, bson.M{"_id": oid}, bson.M{
+				"$inc": bson.M{"refunded.amount": amount.Amount},
+				"$set": bson.M{"refunded.currency": amount.Currency},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return utils.StageEvent(ctx, transactionEvents[kind], model.PaymentEvent{
+			OrderID:     updated.OrderID,
+			IntentID:    updated.ID.Hex(),
+			Status:      updated.Status,
+			Amount:      amount,
+			ProviderRef: ref,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// markPaid moves the order of a captured payment to paid. An order already
+// paid, because the capture was reported twice, is returned as it is. An
+// order cancelled before the capture landed, such as by expiry, gets the
+// captured money back and ErrOrderCancelled.
+func markPaid(ctx context.Context, intent *model.PaymentIntent, actor string) (*model.Order, error) {
+	oid, err := primitive.ObjectIDFromHex(intent.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	order, err := lifecycle.Transition(ctx, bson.M{"_id": oid}, model.StatusPaid, actor, "payment captured")
+	var transitionErr *lifecycle.TransitionError
+	if !errors.As(err, &transitionErr) {
+		return order, err
+	}
+
+	var current model.Order
+	if err := db.MI.DB.Collection("orders").FindOne(ctx, bson.M{"_id": oid}).Decode(&current); err != nil {
+		return nil, err
+	}
+	if current.Status != model.StatusCancelled {
+		return &current, nil
+	}
+	captured, err := Find(ctx, intent.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if left := captured.Captured.Amount - captured.Refunded.Amount; left > 0 {
+		remaining := model.Money{Amount: left, Currency: captured.Captured.Currency}
+		_, err := Refund(ctx, intent.OrderID, remaining, CancellationRefund(intent.OrderID))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &current, ErrOrderCancelled
+}
@@ -0,0 +1,34 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"order-service/model"
+)
+
+var (
+	ErrDeclined        = errors.New("payment declined")
+	ErrNotAuthorized   = errors.New("no authorization to act on")
+	ErrAlreadyCaptured = errors.New("payment has already been captured")
+	ErrNotCaptured     = errors.New("payment has not been captured")
+	ErrRefundTooLarge  = errors.New("refund is larger than what is left to refund")
+)
+
+// Provider is a payment processor orders are paid through. Operations that
+// succeed return the provider's reference for them.
+type Provider interface {
+	Name() string
+	// Authorize holds amount on the customer's payment method. Reference
+	// identifies the order, so retrying an authorization doesn't hold twice.
+	Authorize(ctx context.Context, reference string, amount model.Money) (string, error)
+	// Capture takes amount of an authorization
+	Capture(ctx context.Context, authorizationID string, amount model.Money) (string, error)
+	// Void releases an authorization that won't be captured
+	Void(ctx context.Context, authorizationID string) error
+	// Refund gives back amount of what was captured. Reference identifies
+	// the refund, so retrying it returns the same refund.
+	Refund(ctx context.Context, authorizationID string, amount model.Money, reference string) (string, error)
+}
+
+// Default is the provider orders are paid through, set in main
+var Default Provider = NewFake(0, "")
@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"order-service/db"
+	"order-service/lifecycle"
+	"order-service/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SignatureHeader carries the signature of a webhook, in the form
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of timestamp.body>"
+const SignatureHeader = "Payment-Signature"
+
+// signatureTolerance is how old a webhook signature can be, so a captured
+// webhook can't be replayed later
+const signatureTolerance = 5 * time.Minute
+
+// WebhookSecret is shared with the provider to sign webhooks, set in main
+var WebhookSecret string
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header of a webhook body sent at timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks header is a signature of body by secret made in the last
+// few minutes
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sig = value
+		}
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HandleWebhook applies a verified webhook to the payment it's about. A
+// capture moves the order to paid, and a refund of the whole payment moves
+// it to refunded; the order is returned. A capture of a cancelled order is
+// refunded and returns ErrOrderCancelled. Webhooks are only applied once,
+// and webhooks the service doesn't act on, or that no longer apply to the
+// payment, are ignored.
+func HandleWebhook(ctx context.Context, event model.PaymentWebhook) (*model.Order, error) {
+	webhooks := db.MI.DB.Collection("payment_webhooks")
+	err := webhooks.FindOne(ctx, bson.M{"_id": event.ID}).Err()
+	if err == nil {
+		return nil, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	var intent model.PaymentIntent
+	err = db.MI.DB.Collection("payment_intents").FindOne(ctx, bson.M{"authorization_id": event.AuthorizationID}).Decode(&intent)
+	if err != nil {
+		return nil, err
+	}
+
+	var order *model.Order
+	switch event.Type {
+	case model.WebhookCaptured:
+		updated, err := captured(ctx, &intent, event.ProviderRef, event.Amount, sourceWebhook)
+		if err != nil {
+			return nil, err
+		}
+		if updated.Status != model.PaymentCaptured {
+			log.Printf("Ignoring capture %s of %s payment of order %s", event.ProviderRef, updated.Status, intent.OrderID)
+			break
+		}
+		order, err = markPaid(ctx, updated, intent.Provider)
+		if err == ErrOrderCancelled {
+			// Handled by refunding, remembered so a retry isn't refunded again
+			log.Printf("Refunded capture %s of cancelled order %s", event.ProviderRef, intent.OrderID)
+			return order, remember(ctx, event, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case model.WebhookVoided:
+		if _, err := voided(ctx, &intent, sourceWebhook); err != nil {
+			return nil, err
+		}
+	case model.WebhookRefunded:
+		updated, err := refunded(ctx, &intent, event.ProviderRef, event.Amount, sourceWebhook)
+		if err != nil {
+			return nil, err
+		}
+		if updated.Status == model.PaymentRefunded {
+			oid, _ := primitive.ObjectIDFromHex(intent.OrderID)
+			order, err = lifecycle.Apply(ctx, bson.M{"_id": oid}, lifecycle.Change{
+				Status: model.StatusRefunded,
+				Actor:  intent.Provider,
+				Note:   "payment refunded",
+			})
+			// Cancelled orders stay cancelled
+			var transitionErr *lifecycle.TransitionError
+			if err != nil && !errors.As(err, &transitionErr) {
+				return nil, err
+			}
+		}
+	default:
+		log.Printf("Ignoring %s webhook %s", event.Type, event.ID)
+	}
+
+	// Only remembered once applied, so a failed webhook is applied when the
+	// provider retries it
+	return order, remember(ctx, event, nil)
+}
+
+// remember records a webhook as applied and returns result, or the error
+// recording it
+func remember(ctx context.Context, event model.PaymentWebhook, result error) error {
+	_, err := db.MI.DB.Collection("payment_webhooks").InsertOne(ctx, bson.M{"_id": event.ID, "type": event.Type, "received_at": time.Now().UTC()})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package payment
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"type":"payment.captured","authorization_id":"auth_1"}`)
+	now := time.Unix(1700000000, 0)
+	at := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+	valid := Sign(secret, at(0), body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		wantErr error
+	}{
+		{"valid", secret, valid, body, nil},
+		{"valid with spaces", secret, "t=" + at(0) + ", v1=" + signature(secret, at(0), body), body, nil},
+		{"signed a little while ago", secret, Sign(secret, at(-4*time.Minute), body), body, nil},
+		{"clock slightly ahead", secret, Sign(secret, at(4*time.Minute), body), body, nil},
+		{"too old to replay", secret, Sign(secret, at(-6*time.Minute), body), body, ErrInvalidSignature},
+		{"too far in the future", secret, Sign(secret, at(6*time.Minute), body), body, ErrInvalidSignature},
+		{"other secret", "whsec_other", valid, body, ErrInvalidSignature},
+		{"tampered body", secret, valid, []byte(`{"type":"payment.captured","authorization_id":"auth_2"}`), ErrInvalidSignature},
+		{"timestamp swapped", secret, "t=" + at(time.Minute) + ",v1=" + signature(secret, at(0), body), body, ErrInvalidSignature},
+		{"missing signature", secret, "t=" + at(0), body, ErrInvalidSignature},
+		{"missing timestamp", secret, "v1=" + signature(secret, at(0), body), body, ErrInvalidSignature},
+		{"malformed timestamp", secret, "t=yesterday,v1=" + signature(secret, "yesterday", body), body, ErrInvalidSignature},
+		{"empty header", secret, "", body, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
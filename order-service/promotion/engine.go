@@ -0,0 +1,177 @@
+package promotion
+
+import (
+	"errors"
+	"math"
+	"order-service/model"
+	"sort"
+)
+
+// Line is one product of an order being priced
+type Line struct {
+	ProductName string
+	Category    string
+	Quantity    int
+	UnitPrice   model.Money
+}
+
+// Validate checks a promotion has the parameters its type needs
+func Validate(p *model.Promotion) error {
+	switch p.Type {
+	case model.PromotionPercentage:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return errors.New("percent must be between 0 and 100")
+		}
+	case model.PromotionFixed:
+		if p.Amount == nil || p.Amount.Amount <= 0 || p.Amount.Currency == "" {
+			return errors.New("amount with a positive amount and a currency is required")
+		}
+	case model.PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return errors.New("buy_quantity and get_quantity must be greater than 0")
+		}
+	case model.PromotionTiered:
+		if len(p.Tiers) == 0 {
+			return errors.New("at least one tier is required")
+		}
+		for _, tier := range p.Tiers {
+			if tier.MinQuantity <= 0 || tier.Percent <= 0 || tier.Percent > 100 {
+				return errors.New("tiers need a positive min_quantity and a percent between 0 and 100")
+			}
+		}
+	}
+	if p.EndsAt != nil && !p.EndsAt.After(p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Evaluate works out which promotions apply to the lines of an order and
+// what each takes off. Each promotion discounts what is left of a line after
+// the promotions before it, so a line never goes below zero.
+func Evaluate(promotions []model.Promotion, lines []Line) (model.Money, []model.AppliedPromotion) {
+	total := model.Money{}
+	if len(lines) == 0 {
+		return total, nil
+	}
+	total.Currency = lines[0].UnitPrice.Currency
+
+	remaining := make([]int64, len(lines))
+	for i, line := range lines {
+		remaining[i] = line.UnitPrice.Amount * int64(line.Quantity)
+	}
+
+	sorted := append([]model.Promotion(nil), promotions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority > sorted[j].Priority })
+
+	var applied []model.AppliedPromotion
+	for _, p := range sorted {
+		if !p.Stackable && len(applied) > 0 {
+			continue
+		}
+		discounts := discountLines(p, lines, remaining)
+		var discount int64
+		for i, d := range discounts {
+			if d > remaining[i] {
+				d = remaining[i]
+			}
+			remaining[i] -= d
+			discount += d
+		}
+		if discount == 0 {
+			continue
+		}
+		total.Amount += discount
+		applied = append(applied, model.AppliedPromotion{
+			PromotionID: p.ID,
+			Name:        p.Name,
+			Type:        p.Type,
+			Discount:    model.Money{Amount: discount, Currency: total.Currency},
+		})
+		if !p.Stackable {
+			break
+		}
+	}
+	return total, applied
+}
+
+// discountLines returns what a promotion would take off each line
+func discountLines(p model.Promotion, lines []Line, remaining []int64) []int64 {
+	discounts := make([]int64, len(lines))
+	var matched []int
+	quantity := 0
+	var matchedAmount int64
+	for i, line := range lines {
+		if targets(p, line) {
+			matched = append(matched, i)
+			quantity += line.Quantity
+			matchedAmount += remaining[i]
+		}
+	}
+	if len(matched) == 0 {
+		return discounts
+	}
+
+	switch p.Type {
+	case model.PromotionPercentage:
+		for _, i := range matched {
+			discounts[i] = percentOf(remaining[i], p.Percent)
+		}
+	case model.PromotionFixed:
+		if p.Amount.Currency != lines[0].UnitPrice.Currency || matchedAmount == 0 {
+			return discounts
+		}
+		// Spread the amount over the matched lines in proportion to their value
+		left := p.Amount.Amount
+		if left > matchedAmount {
+			left = matchedAmount
+		}
+		amount := left
+		for n, i := range matched {
+			share := amount * remaining[i] / matchedAmount
+			if n == len(matched)-1 {
+				share = left
+			}
+			discounts[i] = share
+			left -= share
+		}
+	case model.PromotionBuyXGetY:
+		for _, i := range matched {
+			free := lines[i].Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+			discounts[i] = int64(free) * lines[i].UnitPrice.Amount
+		}
+	case model.PromotionTiered:
+		percent := 0.0
+		for _, tier := range p.Tiers {
+			if quantity >= tier.MinQuantity && tier.Percent > percent {
+				percent = tier.Percent
+			}
+		}
+		for _, i := range matched {
+			discounts[i] = percentOf(remaining[i], percent)
+		}
+	}
+	return discounts
+}
+
+// targets reports whether a promotion covers a line
+func targets(p model.Promotion, line Line) bool {
+	if len(p.Products) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	for _, name := range p.Products {
+		if name == line.ProductName {
+			return true
+		}
+	}
+	for _, category := range p.Categories {
+		if category != "" && category == line.Category {
+			return true
+		}
+	}
+	return false
+}
+
+func percentOf(amount int64, percent float64) int64 {
+	return int64(math.Round(float64(amount) * percent / 100))
+}
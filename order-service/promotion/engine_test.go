@@ -0,0 +1,192 @@
+package promotion
+
+import (
+	"order-service/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func eur(amount int64) model.Money { return model.Money{Amount: amount, Currency: "EUR"} }
+
+func TestEvaluate(t *testing.T) {
+	shirt := Line{ProductName: "shirt", Category: "clothing", Quantity: 2, UnitPrice: eur(2000)}
+	socks := Line{ProductName: "socks", Category: "clothing", Quantity: 5, UnitPrice: eur(500)}
+	mug := Line{ProductName: "mug", Category: "kitchen", Quantity: 1, UnitPrice: eur(1000)}
+
+	tests := []struct {
+		name         string
+		promotions   []model.Promotion
+		lines        []Line
+		wantDiscount int64
+		wantApplied  []string
+	}{
+		{
+			name:         "percentage off every line",
+			promotions:   []model.Promotion{{Name: "ten", Type: model.PromotionPercentage, Percent: 10, Stackable: true}},
+			lines:        []Line{shirt, mug},
+			wantDiscount: 500,
+			wantApplied:  []string{"ten"},
+		},
+		{
+			name:         "percentage off a category",
+			promotions:   []model.Promotion{{Name: "kitchen", Type: model.PromotionPercentage, Percent: 50, Categories: []string{"kitchen"}}},
+			lines:        []Line{shirt, mug},
+			wantDiscount: 500,
+			wantApplied:  []string{"kitchen"},
+		},
+		{
+			name:         "fixed amount capped at the matched lines",
+			promotions:   []model.Promotion{{Name: "fiver", Type: model.PromotionFixed, Amount: &model.Money{Amount: 5000, Currency: "EUR"}, Products: []string{"mug"}}},
+			lines:        []Line{shirt, mug},
+			wantDiscount: 1000,
+			wantApplied:  []string{"fiver"},
+		},
+		{
+			name:       "fixed amount in another currency",
+			promotions: []model.Promotion{{Name: "dollars", Type: model.PromotionFixed, Amount: &model.Money{Amount: 500, Currency: "USD"}}},
+			lines:      []Line{shirt},
+		},
+		{
+			name:         "buy two get one free",
+			promotions:   []model.Promotion{{Name: "3for2", Type: model.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1, Products: []string{"socks"}}},
+			lines:        []Line{socks},
+			wantDiscount: 500,
+			wantApplied:  []string{"3for2"},
+		},
+		{
+			name: "tiered by the quantity of matched lines",
+			promotions: []model.Promotion{{Name: "bulk", Type: model.PromotionTiered, Categories: []string{"clothing"}, Tiers: []model.PromotionTier{
+				{MinQuantity: 5, Percent: 5},
+				{MinQuantity: 7, Percent: 20},
+				{MinQuantity: 10, Percent: 50},
+			}}},
+			lines:        []Line{shirt, socks, mug},
+			wantDiscount: 1300,
+			wantApplied:  []string{"bulk"},
+		},
+		{
+			name:       "tiered below the lowest tier",
+			promotions: []model.Promotion{{Name: "bulk", Type: model.PromotionTiered, Tiers: []model.PromotionTier{{MinQuantity: 10, Percent: 50}}}},
+			lines:      []Line{shirt},
+		},
+		{
+			name: "stackable promotions apply to what is left",
+			promotions: []model.Promotion{
+				{Name: "half", Type: model.PromotionPercentage, Percent: 50, Priority: 2, Stackable: true},
+				{Name: "ten", Type: model.PromotionPercentage, Percent: 10, Priority: 1, Stackable: true},
+			},
+			lines:        []Line{mug},
+			wantDiscount: 550,
+			wantApplied:  []string{"half", "ten"},
+		},
+		{
+			name: "a non-stackable promotion ends the evaluation",
+			promotions: []model.Promotion{
+				{Name: "ten", Type: model.PromotionPercentage, Percent: 10, Priority: 1, Stackable: true},
+				{Name: "half", Type: model.PromotionPercentage, Percent: 50, Priority: 2},
+			},
+			lines:        []Line{mug},
+			wantDiscount: 500,
+			wantApplied:  []string{"half"},
+		},
+		{
+			name: "a non-stackable promotion is skipped after another applied",
+			promotions: []model.Promotion{
+				{Name: "ten", Type: model.PromotionPercentage, Percent: 10, Priority: 2, Stackable: true},
+				{Name: "half", Type: model.PromotionPercentage, Percent: 50, Priority: 1},
+			},
+			lines:        []Line{mug},
+			wantDiscount: 100,
+			wantApplied:  []string{"ten"},
+		},
+		{
+			name: "discounts never exceed the line",
+			promotions: []model.Promotion{
+				{Name: "all", Type: model.PromotionPercentage, Percent: 100, Priority: 2, Stackable: true},
+				{Name: "more", Type: model.PromotionFixed, Amount: &model.Money{Amount: 100, Currency: "EUR"}, Priority: 1, Stackable: true},
+			},
+			lines:        []Line{mug},
+			wantDiscount: 1000,
+			wantApplied:  []string{"all"},
+		},
+		{
+			name:       "promotion for other products",
+			promotions: []model.Promotion{{Name: "mugs", Type: model.PromotionPercentage, Percent: 10, Products: []string{"mug"}}},
+			lines:      []Line{shirt},
+		},
+		{
+			name:       "no lines",
+			promotions: []model.Promotion{{Name: "ten", Type: model.PromotionPercentage, Percent: 10}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, applied := Evaluate(tt.promotions, tt.lines)
+			if total.Amount != tt.wantDiscount {
+				t.Errorf("discount = %d, want %d", total.Amount, tt.wantDiscount)
+			}
+			var names []string
+			var sum int64
+			for _, a := range applied {
+				names = append(names, a.Name)
+				sum += a.Discount.Amount
+			}
+			if !reflect.DeepEqual(names, tt.wantApplied) {
+				t.Errorf("applied = %v, want %v", names, tt.wantApplied)
+			}
+			if sum != total.Amount {
+				t.Errorf("applied discounts add up to %d, total is %d", sum, total.Amount)
+			}
+		})
+	}
+}
+
+func TestEvaluateSpreadsFixedAmounts(t *testing.T) {
+	lines := []Line{
+		{ProductName: "a", Quantity: 1, UnitPrice: eur(3000)},
+		{ProductName: "b", Quantity: 1, UnitPrice: eur(1000)},
+	}
+	promotions := []model.Promotion{{Name: "off", Type: model.PromotionFixed, Amount: &model.Money{Amount: 1001, Currency: "EUR"}}}
+
+	total, _ := Evaluate(promotions, lines)
+	if total.Amount != 1001 {
+		t.Fatalf("discount = %d, want 1001", total.Amount)
+	}
+	discounts := discountLines(promotions[0], lines, []int64{3000, 1000})
+	if !reflect.DeepEqual(discounts, []int64{750, 251}) {
+		t.Errorf("discounts = %v, want [750 251]", discounts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := start.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		promotion model.Promotion
+		wantErr   bool
+	}{
+		{"percentage", model.Promotion{Type: model.PromotionPercentage, Percent: 15}, false},
+		{"percentage over 100", model.Promotion{Type: model.PromotionPercentage, Percent: 120}, true},
+		{"percentage of zero", model.Promotion{Type: model.PromotionPercentage}, true},
+		{"fixed", model.Promotion{Type: model.PromotionFixed, Amount: &model.Money{Amount: 500, Currency: "EUR"}}, false},
+		{"fixed without an amount", model.Promotion{Type: model.PromotionFixed}, true},
+		{"fixed without a currency", model.Promotion{Type: model.PromotionFixed, Amount: &model.Money{Amount: 500}}, true},
+		{"buy x get y", model.Promotion{Type: model.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}, false},
+		{"buy x get nothing", model.Promotion{Type: model.PromotionBuyXGetY, BuyQuantity: 2}, true},
+		{"tiered", model.Promotion{Type: model.PromotionTiered, Tiers: []model.PromotionTier{{MinQuantity: 3, Percent: 10}}}, false},
+		{"tiered without tiers", model.Promotion{Type: model.PromotionTiered}, true},
+		{"tiered with a bad tier", model.Promotion{Type: model.PromotionTiered, Tiers: []model.PromotionTier{{MinQuantity: 0, Percent: 10}}}, true},
+		{"ends before it starts", model.Promotion{Type: model.PromotionPercentage, Percent: 10, StartsAt: start, EndsAt: &before}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(&tt.promotion); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package promotion
+
+import (
+	"context"
+	"order-service/db"
+	"order-service/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Active returns the promotions running at now
+func Active(ctx context.Context, now time.Time) ([]model.Promotion, error) {
+	return find(ctx, bson.M{
+		"starts_at": bson.M{"$lte": now},
+		"$or":       bson.A{bson.M{"ends_at": nil}, bson.M{"ends_at": bson.M{"$gt": now}}},
+	})
+}
+
+// All returns every promotion, highest priority first
+func All(ctx context.Context) ([]model.Promotion, error) {
+	return find(ctx, bson.M{})
+}
+
+func find(ctx context.Context, filter bson.M) ([]model.Promotion, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.MI.DB.Collection("promotions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	promotions := []model.Promotion{}
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
@@ -0,0 +1,427 @@
+package returns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"order-service/db"
+	"order-service/lifecycle"
+	"order-service/model"
+	"order-service/payment"
+	"order-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// refundLease is how long a refund holds its return. A refund interrupted
+// by a crash can be retried once it runs out.
+const refundLease = time.Minute
+
+// ReasonInventory is the reason received items are put back in stock with in
+// the product service's ledger
+const ReasonInventory = "return"
+
+var (
+	ErrNotReturnable   = errors.New("only delivered orders can be returned")
+	ErrRefundInProcess = errors.New("return is already being refunded")
+)
+
+// ItemError is returned for a return item that doesn't match the order
+type ItemError struct {
+	ProductName string
+	Message     string
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ProductName, e.Message)
+}
+
+// StatusError is returned for a move a return can't make from its status
+type StatusError struct {
+	From string
+	To   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("return can't move from %s to %s", e.From, e.To)
+}
+
+// from lists the status a return must be in to move to each status
+var from = map[string]string{
+	model.ReturnApproved: model.ReturnRequested,
+	model.ReturnRejected: model.ReturnRequested,
+	model.ReturnReceived: model.ReturnApproved,
+	model.ReturnRefunded: model.ReturnReceived,
+}
+
+var events = map[string]string{
+	model.ReturnRequested: model.EventReturnRequested,
+	model.ReturnApproved:  model.EventReturnApproved,
+	model.ReturnRejected:  model.EventReturnRejected,
+	model.ReturnReceived:  model.EventReturnReceived,
+	model.ReturnRefunded:  model.EventReturnRefunded,
+}
+
+// Init creates the indexes returns are looked up by
+func Init() error {
+	_, err := db.MI.DB.Collection("returns").Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "number", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "order_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+	return err
+}
+
+// Find returns the return matching filter
+func Find(ctx context.Context, filter bson.M) (*model.Return, error) {
+	var r model.Return
+	if err := db.MI.DB.Collection("returns").FindOne(ctx, filter).Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// List returns the returns matching filter, newest first
+func List(ctx context.Context, filter bson.M) ([]model.Return, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.MI.DB.Collection("returns").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	returns := []model.Return{}
+	if err := cursor.All(ctx, &returns); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// Request opens a return for items of a delivered order. Each item must be
+// a line of the order, and no more can be returned than was ordered across
+// all of the order's returns that weren't rejected. The quantities are
+// counted on the order lines as they are taken, so concurrent requests
+// can't return more than was ordered either.
+func Request(ctx context.Context, order *model.Order, actor string, items []model.ReturnItem) (*model.Return, error) {
+	if order.Status != model.StatusDelivered {
+		return nil, ErrNotReturnable
+	}
+
+	lines := make(map[string]model.LineItem, len(order.Items))
+	for _, line := range order.Items {
+		lines[line.ProductName] = line
+	}
+	merged := make([]model.ReturnItem, 0, len(items))
+	index := make(map[string]int)
+	for _, item := range items {
+		if i, ok := index[item.ProductName]; ok {
+			merged[i].Quantity += item.Quantity
+			continue
+		}
+		line, ok := lines[item.ProductName]
+		if !ok {
+			return nil, &ItemError{ProductName: item.ProductName, Message: "not part of the order"}
+		}
+		item.UnitPrice = line.UnitPrice
+		index[item.ProductName] = len(merged)
+		merged = append(merged, item)
+	}
+
+	for i, item := range merged {
+		if err := take(ctx, order.ID, item.ProductName, item.Quantity); err != nil {
+			giveBack(ctx, order.ID, merged[:i])
+			return nil, err
+		}
+	}
+
+	n, err := db.NextSequence(ctx, "return_number")
+	if err != nil {
+		giveBack(ctx, order.ID, merged)
+		return nil, err
+	}
+	now := time.Now().UTC()
+	r := &model.Return{
+		ID:          primitive.NewObjectID(),
+		Number:      fmt.Sprintf("RMA-%06d", n),
+		OrderID:     order.ID.Hex(),
+		OrderNumber: order.Number,
+		UserID:      order.UserID,
+		Items:       merged,
+		Status:      model.ReturnRequested,
+		History:     []model.StatusChange{{Status: model.ReturnRequested, Actor: actor, At: now}},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	err = utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		if _, err := db.MI.DB.Collection("returns").InsertOne(ctx, r); err != nil {
+			return err
+		}
+		return stage(ctx, r, "", now)
+	})
+	if err != nil {
+		giveBack(ctx, order.ID, merged)
+		return nil, err
+	}
+	return r, nil
+}
+
+// take counts quantity of a line of an order as returned, if that many are
+// left. The update only applies while the line's returned count is the one
+// read, and is retried otherwise.
+func take(ctx context.Context, orderID primitive.ObjectID, name string, quantity int) error {
+	orders := db.MI.DB.Collection("orders")
+	for {
+		var order model.Order
+		if err := orders.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order); err != nil {
+			return err
+		}
+		var line *model.LineItem
+		for i := range order.Items {
+			if order.Items[i].ProductName == name {
+				line = &order.Items[i]
+			}
+		}
+		if line == nil {
+			return &ItemError{ProductName: name, Message: "not part of the order"}
+		}
+		if left := line.Quantity - line.Returned; quantity > left {
+			return &ItemError{ProductName: name, Message: fmt.Sprintf("only %d left to return", left)}
+		}
+
+		var returned interface{} = line.Returned
+		if line.Returned == 0 {
+			returned = bson.M{"$in": bson.A{0, nil}}
+		}
+		res, err := orders.UpdateOne(ctx,
+			bson.M{"_id": orderID, "items": bson.M{"$elemMatch": bson.M{"name": name, "returned": returned}}},
+			bson.M{"$inc": bson.M{"items.$.returned": quantity}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 1 {
+			return nil
+		}
+	}
+}
+
+// giveBack uncounts the items of a return that won't go ahead, so they can
+// be requested again
+func giveBack(ctx context.Context, orderID primitive.ObjectID, items []model.ReturnItem) error {
+	for _, item := range items {
+		_, err := db.MI.DB.Collection("orders").UpdateOne(ctx,
+			bson.M{"_id": orderID, "items.name": item.ProductName},
+			bson.M{"$inc": bson.M{"items.$.returned": -item.Quantity}})
+		if err != nil {
+			log.Printf("Error giving back returned %s of order %s: %v", item.ProductName, orderID.Hex(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Approve accepts a requested return, so the items can be sent back
+func Approve(ctx context.Context, filter bson.M, actor, note string) (*model.Return, error) {
+	return move(ctx, filter, model.ReturnApproved, actor, note, nil)
+}
+
+// Reject turns down a requested return. Its items can be requested again.
+func Reject(ctx context.Context, filter bson.M, actor, note string) (*model.Return, error) {
+	r, err := move(ctx, filter, model.ReturnRejected, actor, note, nil)
+	if err != nil {
+		return nil, err
+	}
+	oid, _ := primitive.ObjectIDFromHex(r.OrderID)
+	return r, giveBack(ctx, oid, r.Items)
+}
+
+// Receive confirms the items of an approved return arrived and puts them
+// back in stock. If restocking fails, receiving the return again carries on
+// where it stopped.
+func Receive(ctx context.Context, filter bson.M, actor string) (*model.Return, error) {
+	r, err := move(ctx, filter, model.ReturnReceived, actor, "", nil)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.From == model.ReturnReceived {
+		if r, err = Find(ctx, filter); err != nil {
+			return nil, err
+		}
+		if len(r.Restocked) == len(r.Items) {
+			return nil, statusErr
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	restocked := make(map[string]bool, len(r.Restocked))
+	for _, name := range r.Restocked {
+		restocked[name] = true
+	}
+	for _, item := range r.Items {
+		if restocked[item.ProductName] {
+			continue
+		}
+		// Archived products hold no stock to give back to
+		err := utils.UpdateProductInventory(item.ProductName, item.Quantity, ReasonInventory, r.ID.Hex())
+		if err != nil && !errors.Is(err, utils.ErrProductArchived) {
+			return r, err
+		}
+		r.Restocked = append(r.Restocked, item.ProductName)
+		_, err = db.MI.DB.Collection("returns").UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{"restocked": r.Restocked}})
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// Refund gives back amount for a received return through the order's
+// payment, or the items' share of the order total when amount is nil. An
+// order whose payment is then fully refunded moves to refunded.
+//
+// The refund is claimed on the return with its amount for a short lease, so
+// the same return isn't refunded twice at once. The payment refund is made
+// with the return's ID as reference, so a refund interrupted after the money
+// moved can be retried, once the lease runs out, without refunding twice.
+func Refund(ctx context.Context, filter bson.M, actor string, amount *model.Money) (*model.Return, error) {
+	r, err := Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != model.ReturnReceived {
+		return nil, &StatusError{From: r.Status, To: model.ReturnRefunded}
+	}
+	oid, _ := primitive.ObjectIDFromHex(r.OrderID)
+	var order model.Order
+	if err := db.MI.DB.Collection("orders").FindOne(ctx, bson.M{"_id": oid}).Decode(&order); err != nil {
+		return nil, err
+	}
+	switch {
+	case r.Refund != nil:
+		// Resuming an interrupted refund, which may already have been paid
+		amount = r.Refund
+	case amount == nil:
+		amount = value(r, &order)
+	case amount.Currency == "":
+		amount.Currency = order.Total.Currency
+	}
+
+	returns := db.MI.DB.Collection("returns")
+	now := time.Now().UTC()
+	res, err := returns.UpdateOne(ctx,
+		bson.M{
+			"_id":    r.ID,
+			"status": model.ReturnReceived,
+			"$or": bson.A{
+				bson.M{"refunding_until": bson.M{"$exists": false}},
+				bson.M{"refunding_until": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"refunding_until": now.Add(refundLease), "refund": amount}})
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, ErrRefundInProcess
+	}
+
+	intent, err := payment.Refund(ctx, r.OrderID, *amount, r.ID.Hex())
+	if err != nil {
+		unset := bson.M{"refunding_until": ""}
+		switch err {
+		case payment.ErrInvalidAmount, payment.ErrRefundTooLarge, payment.ErrNotCaptured, payment.ErrDeclined:
+			// Nothing was refunded, so another amount can be tried
+			unset["refund"] = ""
+		}
+		if _, unclaimErr := returns.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$unset": unset}); unclaimErr != nil {
+			log.Printf("Error releasing the refund of return %s: %v", r.Number, unclaimErr)
+		}
+		return nil, err
+	}
+	r, err = move(ctx, bson.M{"_id": r.ID}, model.ReturnRefunded, actor, "", bson.M{"refund": amount})
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status == model.PaymentRefunded {
+		_, err := lifecycle.Transition(ctx, bson.M{"_id": oid}, model.StatusRefunded, actor, "refunded by return "+r.Number)
+		var transitionErr *lifecycle.TransitionError
+		if err != nil && !errors.As(err, &transitionErr) {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// value is the share of the order total paid for the returned items, after
+// the order's discounts and tax
+func value(r *model.Return, order *model.Order) *model.Money {
+	amount := model.Money{Currency: order.Total.Currency}
+	if order.Subtotal.Amount == 0 {
+		return &amount
+	}
+	var items int64
+	for _, item := range r.Items {
+		items += item.UnitPrice.Amount * int64(item.Quantity)
+	}
+	amount.Amount = int64(math.Round(float64(items) * float64(order.Total.Amount) / float64(order.Subtotal.Amount)))
+	return &amount
+}
+
+// move changes the status of the return matching filter, records it in its
+// history and publishes the status event. Like orders, the update only
+// applies if the return is still in the status it was read in.
+func move(ctx context.Context, filter bson.M, status, actor, note string, set bson.M) (*model.Return, error) {
+	current, err := Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if current.Status != from[status] {
+		return nil, &StatusError{From: current.Status, To: status}
+	}
+
+	now := time.Now().UTC()
+	change := model.StatusChange{From: current.Status, Status: status, Actor: actor, Note: note, At: now}
+	update := bson.M{"status": status, "updated_at": now}
+	for field, value := range set {
+		update[field] = value
+	}
+	var r model.Return
+	err = utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		err := db.MI.DB.Collection("returns").FindOneAndUpdate(ctx,
+			bson.M{"_id": current.ID, "status": current.Status},
+			bson.M{"$set": update, "$push": bson.M{"status_history": change}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&r)
+		if err != nil {
+			return err
+		}
+		return stage(ctx, &r, note, now)
+	})
+	if err == mongo.ErrNoDocuments {
+		// Someone else moved the return first, report against its new status
+		return move(ctx, bson.M{"_id": current.ID}, status, actor, note, set)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func stage(ctx context.Context, r *model.Return, note string, at time.Time) error {
+	return utils.StageEvent(ctx, events[r.Status], model.ReturnEvent{
+		ReturnID:    r.ID.Hex(),
+		Number:      r.Number,
+		OrderID:     r.OrderID,
+		OrderNumber: r.OrderNumber,
+		UserID:      r.UserID,
+		Status:      r.Status,
+		Items:       r.Items,
+		Refund:      r.Refund,
+		Note:        note,
+		At:          at,
+	})
+}
@@ -0,0 +1,180 @@
+package saga
+
+import (
+	"context"
+	"log"
+	"order-service/coupon"
+	"order-service/db"
+	"order-service/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lease is how long the process running a saga holds it. A saga whose lease
+// runs out, because its process crashed, is resumed by the recovery job.
+const lease = time.Minute
+
+// Init creates the indexes sagas are looked up and recovered by
+func Init() error {
+	_, err := db.MI.DB.Collection("sagas").Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_number", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}}},
+	})
+	return err
+}
+
+// Place runs the saga that places a priced order: reserve its stock,
+// authorize its payment and confirm it. When a step fails the steps before
+// it are compensated in reverse order and the step's error is returned.
+func Place(ctx context.Context, order model.Order) (*model.Saga, error) {
+	now := time.Now().UTC()
+	s := &model.Saga{
+		ID:          order.ID,
+		OrderNumber: order.Number,
+		Status:      model.SagaRunning,
+		Order:       order,
+		LockedUntil: now.Add(lease),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, st := range steps {
+		s.Steps = append(s.Steps, model.SagaStep{Name: st.name, Status: model.StepPending})
+	}
+	if _, err := db.MI.DB.Collection("sagas").InsertOne(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, execute(ctx, s)
+}
+
+// Find returns the saga of an order
+func Find(ctx context.Context, filter bson.M) (*model.Saga, error) {
+	var s model.Saga
+	err := db.MI.DB.Collection("sagas").FindOne(ctx, filter).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// execute runs the saga forward from its first unfinished step, then
+// compensates if a step failed. It returns the error of the failed step.
+func execute(ctx context.Context, s *model.Saga) error {
+	var stepErr error
+	if s.Status == model.SagaRunning {
+		for i, st := range steps {
+			if s.Steps[i].Status == model.StepDone {
+				continue
+			}
+			started := time.Now().UTC()
+			s.Steps[i].Status = model.StepRunning
+			s.Steps[i].StartedAt = &started
+			if err := save(ctx, s); err != nil {
+				return err
+			}
+
+			stepErr = st.run(ctx, s)
+			finished := time.Now().UTC()
+			s.Steps[i].FinishedAt = &finished
+			if stepErr != nil {
+				log.Printf("Order %s failed at %s: %v", s.ID.Hex(), st.name, stepErr)
+				s.Steps[i].Status = model.StepFailed
+				s.Steps[i].Error = stepErr.Error()
+				s.Status = model.SagaCompensating
+				s.Error = stepErr.Error()
+				if err := save(ctx, s); err != nil {
+					return err
+				}
+				break
+			}
+			s.Steps[i].Status = model.StepDone
+			if err := save(ctx, s); err != nil {
+				return err
+			}
+		}
+		if s.Status == model.SagaRunning {
+			s.Status = model.SagaCompleted
+			return save(ctx, s)
+		}
+	}
+
+	if s.Status == model.SagaCompensating {
+		if err := compensate(ctx, s); err != nil {
+			// Left compensating for the recovery job to retry
+			log.Printf("Error compensating order %s: %v", s.ID.Hex(), err)
+		}
+	}
+	return stepErr
+}
+
+// compensate undoes every step that ran, last first, and gives back the
+// order's coupon
+func compensate(ctx context.Context, s *model.Saga) error {
+	for i := len(steps) - 1; i >= 0; i-- {
+		switch s.Steps[i].Status {
+		case model.StepPending, model.StepCompensated:
+			continue
+		}
+		if steps[i].compensate != nil {
+			if err := steps[i].compensate(ctx, s); err != nil {
+				return err
+			}
+		}
+		s.Steps[i].Status = model.StepCompensated
+		if err := save(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	if s.Order.Coupon != nil {
+		if err := coupon.Release(ctx, &model.Coupon{Code: s.Order.Coupon.Code}, s.Order.UserID); err != nil {
+			return err
+		}
+	}
+	s.Status = model.SagaFailed
+	return save(ctx, s)
+}
+
+// save persists the saga and extends its lease
+func save(ctx context.Context, s *model.Saga) error {
+	now := time.Now().UTC()
+	s.UpdatedAt = now
+	s.LockedUntil = now.Add(lease)
+	_, err := db.MI.DB.Collection("sagas").ReplaceOne(ctx, bson.M{"_id": s.ID}, s)
+	return err
+}
+
+// Recover resumes the sagas left unfinished by a crashed process. Each is
+// claimed by taking its expired lease, so replicas don't resume the same saga.
+func Recover(ctx context.Context) {
+	for {
+		now := time.Now().UTC()
+		var s model.Saga
+		err := db.MI.DB.Collection("sagas").FindOneAndUpdate(ctx,
+			bson.M{
+				"status":       bson.M{"$in": bson.A{model.SagaRunning, model.SagaCompensating}},
+				"locked_until": bson.M{"$lt": now},
+			},
+			bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&s)
+		if err == mongo.ErrNoDocuments {
+			return
+		}
+		if err != nil {
+			log.Printf("Error claiming saga: %v", err)
+			return
+		}
+		log.Printf("Resuming saga of order %s (%s)", s.ID.Hex(), s.Status)
+		execute(ctx, &s)
+	}
+}
+
+// RunRecovery resumes unfinished sagas every interval
+func RunRecovery(interval time.Duration) {
+	for {
+		Recover(context.TODO())
+		time.Sleep(interval)
+	}
+}
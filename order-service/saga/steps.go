@@ -0,0 +1,129 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"order-service/db"
+	"order-service/model"
+	"order-service/payment"
+	"order-service/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Steps of an order placement
+const (
+	StepReserveStock     = "reserve_stock"
+	StepAuthorizePayment = "authorize_payment"
+	StepConfirmOrder     = "confirm_order"
+)
+
+type step struct {
+	name       string
+	run        func(ctx context.Context, s *model.Saga) error
+	compensate func(ctx context.Context, s *model.Saga) error
+}
+
+// Each step must be safe to run again after a crash, and each compensation
+// must undo whatever part of its step took effect
+var steps = []step{
+	{StepReserveStock, reserveStock, releaseStock},
+	{StepAuthorizePayment, authorizePayment, voidPayment},
+	{StepConfirmOrder, confirmOrder, nil},
+}
+
+// reserveStock reserves every line item, saving progress after each. The
+// product service applies a reservation once per order ID, so a line
+// reserved just before a crash isn't reserved again when the saga resumes.
+func reserveStock(ctx context.Context, s *model.Saga) error {
+	reserved := make(map[string]bool, len(s.Reserved))
+	for _, name := range s.Reserved {
+		reserved[name] = true
+	}
+	for _, item := range s.Order.Items {
+		if reserved[item.ProductName] {
+			continue
+		}
+		if err := utils.UpdateProductInventory(item.ProductName, -item.Quantity, "order", s.ID.Hex()); err != nil {
+			return err
+		}
+		s.Reserved = append(s.Reserved, item.ProductName)
+		if err := save(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseStock(ctx context.Context, s *model.Saga) error {
+	for len(s.Reserved) > 0 {
+		name := s.Reserved[len(s.Reserved)-1]
+		for _, item := range s.Order.Items {
+			if item.ProductName != name {
+				continue
+			}
+			// Archived products hold no stock to give back to
+			err := utils.UpdateProductInventory(name, item.Quantity, "order", s.ID.Hex())
+			if err != nil && !errors.Is(err, utils.ErrProductArchived) {
+				return err
+			}
+		}
+		s.Reserved = s.Reserved[:len(s.Reserved)-1]
+		if err := save(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func authorizePayment(ctx context.Context, s *model.Saga) error {
+	if s.AuthorizationID != "" {
+		return nil
+	}
+	intent, err := payment.Authorize(ctx, s.ID.Hex(), s.Order.Total)
+	if err != nil {
+		return err
+	}
+	s.AuthorizationID = intent.AuthorizationID
+	return save(ctx, s)
+}
+
+func voidPayment(ctx context.Context, s *model.Saga) error {
+	if s.AuthorizationID == "" {
+		return nil
+	}
+	if _, err := payment.Void(ctx, s.ID.Hex()); err != nil {
+		return err
+	}
+	s.AuthorizationID = ""
+	return save(ctx, s)
+}
+
+// confirmOrder saves the order, which is only visible once its stock and
+// payment are secured, and announces it. The order and its event are written
+// in one transaction.
+func confirmOrder(ctx context.Context, s *model.Saga) error {
+	items := make([]model.EventItem, 0, len(s.Order.Items))
+	for _, item := range s.Order.Items {
+		items = append(items, model.EventItem{ProductName: item.ProductName, Quantity: item.Quantity})
+	}
+	return utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		_, err := db.MI.DB.Collection("orders").InsertOne(ctx, s.Order)
+		if mongo.IsDuplicateKeyError(err) {
+			// Confirmed before a crash, and announced with it
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := utils.StageEvents(ctx, "Order_created"); err != nil {
+			return err
+		}
+		return utils.StageEvent(ctx, model.EventOrderCreated, model.OrderCreatedEvent{
+			OrderID: s.ID.Hex(),
+			UserID:  s.Order.UserID,
+			Items:   items,
+			Total:   s.Order.Total,
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// minorUnits lists the currencies that do not use two decimal places
+var minorUnits = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// BaseCurrency returns the currency of the product catalogue, from the
+// BASE_CURRENCY environment variable (default USD)
+func BaseCurrency() string {
+	if base := os.Getenv("BASE_CURRENCY"); base != "" {
+		return strings.ToUpper(base)
+	}
+	return "USD"
+}
+
+// MinorUnit returns how many minor units make one unit of the currency
+func MinorUnit(code string) int64 {
+	exp, ok := minorUnits[code]
+	if !ok {
+		exp = 2
+	}
+	unit := int64(1)
+	for i := 0; i < exp; i++ {
+		unit *= 10
+	}
+	return unit
+}
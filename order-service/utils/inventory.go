@@ -3,36 +3,74 @@ package utils
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"shared/auth"
+	"time"
 )
 
-// UpdateProductInventory updates the product inventory by making a PUT request to the product service
-func UpdateProductInventory(productName string, quantity int) error {
-	url := fmt.Sprintf("http://localhost:8082/product/%s", productName)
+// inventoryClient sends inventory changes to the product service. The
+// timeout keeps a stuck product service from holding a placement or a
+// cancellation forever; the change is safe to retry.
+var inventoryClient = &http.Client{Timeout: 10 * time.Second}
+
+// AuthSecret signs the token the service sends to the product service, so
+// inventory changes are recorded under "order-service". It is set from
+// JWT_SECRET at startup.
+var AuthSecret []byte
+
+// ErrInsufficientInventory is returned when the product service can't
+// reserve the quantity asked for
+var ErrInsufficientInventory = errors.New("insufficient inventory")
+
+// ErrProductArchived is returned when the product service refuses to change
+// the stock of an archived product
+var ErrProductArchived = errors.New("product is archived")
+
+// UpdateProductInventory updates the product inventory by making a PUT request to the product service.
+// The reason and reference ID are recorded in the product service's inventory ledger,
+// which applies a change only once per reference, so the call is safe to retry.
+func UpdateProductInventory(productName string, quantity int, reason, referenceID string) error {
+	productURL := fmt.Sprintf("http://localhost:8082/product/%s", url.PathEscape(productName))
 
 	// Create the request body
-	requestBody, err := json.Marshal(map[string]int{"quantity": quantity})
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"quantity":     quantity,
+		"reason":       reason,
+		"reference_id": referenceID,
+	})
 	if err != nil {
 		return fmt.Errorf("error marshaling request body: %v", err)
 	}
 
 	// Create a new PUT request
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequest(http.MethodPut, productURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return fmt.Errorf("error creating PUT request: %v", err)
 	}
+	token, err := auth.ServiceToken(AuthSecret, "order-service")
+	if err != nil {
+		return fmt.Errorf("error signing service token: %v", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := inventoryClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending PUT request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Check the response status code
+	if resp.StatusCode == http.StatusConflict {
+		return ErrInsufficientInventory
+	}
+	if resp.StatusCode == http.StatusGone {
+		return ErrProductArchived
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("received non-OK response: %s", resp.Status)
 	}
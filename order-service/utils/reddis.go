@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var RDB *redis.Client
@@ -46,3 +47,25 @@ func GetKey(key string) (string, error) {
 	log.Printf("Key %s retrieved successfully", key)
 	return val, nil
 }
+
+// unlockScript deletes a lock only if it is still held with the token it
+// was taken with, so a lock that expired and was taken by another process
+// isn't released by mistake
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// TryLock takes the named lock for ttl if no other process holds it, and
+// returns the token to release it with. The lock is shared by every replica.
+func TryLock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	token := primitive.NewObjectID().Hex()
+	ok, err := RDB.SetNX(ctx, key, token, ttl).Result()
+	return token, ok, err
+}
+
+// Unlock releases a lock taken with TryLock
+func Unlock(ctx context.Context, key, token string) error {
+	return unlockScript.Run(ctx, RDB, []string{key}, token).Err()
+}
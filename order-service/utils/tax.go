@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// TaxRate returns the sales tax charged on orders as a percentage, from the
+// TAX_RATE environment variable (default 0)
+func TaxRate() float64 {
+	value := os.Getenv("TAX_RATE")
+	if value == "" {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 {
+		log.Printf("Ignoring invalid TAX_RATE %q", value)
+		return 0
+	}
+	return rate
+}
@@ -0,0 +1,117 @@
+package archive
+
+import (
+	"context"
+	"log"
+	"product-service/bundle"
+	"product-service/db"
+	"product-service/media"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Archive hides a product from listings and new orders by stamping
+// deleted_at. It stays resolvable by name for past orders.
+func Archive(ctx context.Context, productName string) (*model.Product, error) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOneAndUpdate(ctx,
+		bson.M{"name": productName, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now().UTC()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	utils.InvalidateProduct(productName)
+	bundle.InvalidateContaining(ctx, productName)
+	return &product, nil
+}
+
+// Restore brings an archived product back
+func Restore(ctx context.Context, productName string) (*model.Product, error) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOneAndUpdate(ctx,
+		bson.M{"name": productName, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	utils.InvalidateProduct(productName)
+	bundle.InvalidateContaining(ctx, productName)
+	return &product, nil
+}
+
+// Archived returns the archived products, most recently archived first
+func Archived(ctx context.Context) ([]model.Product, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"deleted_at": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := []model.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// Purge permanently deletes the products archived before cutoff along with
+// their stock levels and images, returning how many were deleted
+func Purge(ctx context.Context, cutoff time.Time) (int, error) {
+	products, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	defer products.Close(ctx)
+
+	purged := 0
+	for products.Next(ctx) {
+		var product model.Product
+		if err := products.Decode(&product); err != nil {
+			return purged, err
+		}
+		// Only delete it if it wasn't restored in the meantime
+		result, err := db.MI.DB.Collection("products").DeleteOne(ctx,
+			bson.M{"name": product.ProductName, "deleted_at": bson.M{"$lt": cutoff}})
+		if err != nil {
+			return purged, err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		purged++
+		utils.InvalidateProduct(product.ProductName)
+
+		if _, err := db.MI.DB.Collection("stock").DeleteMany(ctx, bson.M{"name": product.ProductName}); err != nil {
+			log.Printf("Error deleting stock levels for %s: %v", product.ProductName, err)
+		}
+		if len(product.Images) > 0 {
+			if err := media.Store.Delete(ctx, product.ID); err != nil {
+				log.Printf("Error deleting images for %s: %v", product.ProductName, err)
+			}
+		}
+	}
+	return purged, products.Err()
+}
+
+// RunPurge purges products archived for longer than retention every interval
+func RunPurge(interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purged, err := Purge(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Error purging archived products: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d archived products", purged)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Prepare checks the components and pricing of a new bundle. A bundle holds
+// no stock of its own, and a discount-priced bundle gets its price from its
+// components.
+func Prepare(ctx context.Context, bundle *model.Product) error {
+	if len(bundle.Components) == 0 {
+		return errors.New("a bundle needs at least one component")
+	}
+	seen := make(map[string]bool)
+	for _, component := range bundle.Components {
+		if component.Quantity <= 0 {
+			return fmt.Errorf("component %s needs a quantity greater than 0", component.ProductName)
+		}
+		if component.ProductName == bundle.ProductName || seen[component.ProductName] {
+			return fmt.Errorf("component %s is listed twice", component.ProductName)
+		}
+		seen[component.ProductName] = true
+	}
+
+	components, err := load(ctx, bundle.Components)
+	if err != nil {
+		return err
+	}
+	for _, component := range bundle.Components {
+		p, ok := components[component.ProductName]
+		switch {
+		case !ok || p.DeletedAt != nil:
+			return fmt.Errorf("component %s not found", component.ProductName)
+		case p.Type == model.ProductTypeBundle:
+			return fmt.Errorf("component %s is itself a bundle", component.ProductName)
+		}
+	}
+
+	if bundle.BundlePricing == nil {
+		bundle.BundlePricing = &model.BundlePricing{Mode: model.BundlePriceFixed}
+	}
+	switch bundle.BundlePricing.Mode {
+	case model.BundlePriceFixed:
+		bundle.BundlePricing.Percent = 0
+	case model.BundlePriceDiscount:
+		if bundle.BundlePricing.Percent < 0 || bundle.BundlePricing.Percent >= 100 {
+			return errors.New("bundle discount percent must be between 0 and 100")
+		}
+		if bundle.Price, err = price(bundle, components); err != nil {
+			return err
+		}
+	default:
+		return errors.New("bundle pricing mode must be fixed or discount")
+	}
+
+	bundle.Quantity = 0
+	return nil
+}
+
+// Resolve fills in what a bundle depends on its components for: the number
+// of bundles their stock makes up and, for discount pricing, the price
+func Resolve(ctx context.Context, bundle *model.Product) error {
+	if bundle.Type != model.ProductTypeBundle {
+		return nil
+	}
+	components, err := load(ctx, bundle.Components)
+	if err != nil {
+		return err
+	}
+
+	available := math.MaxInt
+	for _, component := range bundle.Components {
+		p, ok := components[component.ProductName]
+		if !ok || p.DeletedAt != nil {
+			available = 0
+			break
+		}
+		if n := p.Quantity / component.Quantity; n < available {
+			available = n
+		}
+	}
+	if available < 0 || available == math.MaxInt {
+		available = 0
+	}
+	bundle.Quantity = available
+
+	if bundle.BundlePricing != nil && bundle.BundlePricing.Mode == model.BundlePriceDiscount {
+		p, err := price(bundle, components)
+		if err != nil {
+			// Components priced in other currencies can't be summed, the
+			// price stored when the bundle was created still applies
+			log.Printf("Error pricing bundle %s: %v", bundle.ProductName, err)
+			return nil
+		}
+		bundle.Price = p
+		bundle.RegularPrice = p
+	}
+	return nil
+}
+
+// InvalidateContaining evicts the cached bundles a product is a component of,
+// since their availability and price follow it
+func InvalidateContaining(ctx context.Context, productName string) {
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"components.name": productName})
+	if err != nil {
+		log.Printf("Error finding bundles containing %s: %v", productName, err)
+		return
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var bundle model.Product
+		if err := cursor.Decode(&bundle); err == nil {
+			utils.InvalidateProduct(bundle.ProductName)
+		}
+	}
+}
+
+// price sums the component prices and takes the bundle discount off
+func price(bundle *model.Product, components map[string]model.Product) (model.Money, error) {
+	total := model.Money{}
+	for _, component := range bundle.Components {
+		p, ok := components[component.ProductName]
+		if !ok {
+			return total, fmt.Errorf("component %s not found", component.ProductName)
+		}
+		if total.Currency == "" {
+			total.Currency = p.Price.Currency
+		} else if p.Price.Currency != total.Currency {
+			return total, errors.New("bundle components are priced in different currencies")
+		}
+		total.Amount += p.Price.Amount * int64(component.Quantity)
+	}
+	total.Amount = int64(math.Round(float64(total.Amount) * (100 - bundle.BundlePricing.Percent) / 100))
+	return total, nil
+}
+
+func load(ctx context.Context, components []model.BundleComponent) (map[string]model.Product, error) {
+	names := make([]string, 0, len(components))
+	for _, component := range components {
+		names = append(names, component.ProductName)
+	}
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := make(map[string]model.Product, len(names))
+	for cursor.Next(ctx) {
+		var p model.Product
+		if err := cursor.Decode(&p); err != nil {
+			return nil, err
+		}
+		products[p.ProductName] = p
+	}
+	return products, cursor.Err()
+}
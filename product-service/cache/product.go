@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"product-service/metrics"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	productTTL = 5 * time.Minute
+	// Misses are cached briefly so lookups of unknown products don't all
+	// reach the database, without hiding a product created just after
+	missTTL = 30 * time.Second
+
+	missMarker = "__not_found__"
+)
+
+var ErrNotFound = errors.New("product not found")
+
+var group singleflight.Group
+
+// Product returns a product from the cache, or loads it and caches it.
+// Concurrent misses for the same product share a single load, and a product
+// that doesn't exist is remembered as missing for a short while.
+func Product(ctx context.Context, productName string, load func(context.Context, string) (*model.Product, error)) (model.Product, error) {
+	key := "product:" + productName
+
+	val, err := utils.RDB.Get(ctx, key).Result()
+	if err == nil {
+		if val == missMarker {
+			metrics.CacheHits.WithLabelValues("product").Inc()
+			return model.Product{}, ErrNotFound
+		}
+		var product model.Product
+		if err := json.Unmarshal([]byte(val), &product); err == nil {
+			metrics.CacheHits.WithLabelValues("product").Inc()
+			return product, nil
+		}
+	} else if err != redis.Nil {
+		log.Printf("Error reading cache: %v", err)
+	}
+	metrics.CacheMisses.WithLabelValues("product").Inc()
+
+	v, err, _ := group.Do(key, func() (interface{}, error) {
+		gen, err := utils.RDB.Get(ctx, utils.ProductGenerationKey(productName)).Result()
+		if err != nil && err != redis.Nil {
+			log.Printf("Error reading cache generation: %v", err)
+		}
+		product, err := load(ctx, productName)
+		if err == mongo.ErrNoDocuments {
+			store(ctx, productName, gen, missMarker, missTTL)
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(product)
+		if err == nil {
+			store(ctx, productName, gen, data, productTTL)
+		}
+		return *product, nil
+	})
+	if err != nil {
+		return model.Product{}, err
+	}
+	// Each caller gets its own copy since callers localize prices in place
+	return v.(model.Product), nil
+}
+
+// store caches a product read while its generation was gen. If the product
+// was invalidated since, the read may be stale and is not cached.
+func store(ctx context.Context, productName, gen string, value interface{}, ttl time.Duration) {
+	genKey := utils.ProductGenerationKey(productName)
+	err := utils.RDB.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, genKey).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != gen {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, "product:"+productName, value, ttl)
+			return nil
+		})
+		return err
+	}, genKey)
+	// A failed transaction means an invalidation got in, which is fine
+	if err != nil && err != redis.TxFailedErr {
+		log.Printf("Error setting cache: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"product-service/model"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ValidateDefinition checks the attribute definitions of a category
+func ValidateDefinition(category *model.Category) error {
+	seen := make(map[string]bool)
+	for _, def := range category.Attributes {
+		if def.Name == "" || strings.ContainsAny(def.Name, ".$") {
+			return fmt.Errorf("invalid attribute name %q", def.Name)
+		}
+		if seen[def.Name] {
+			return fmt.Errorf("attribute %s is defined twice", def.Name)
+		}
+		seen[def.Name] = true
+
+		switch def.Type {
+		case model.AttributeNumber:
+			if def.Unit != "" && !KnownUnit(def.Unit) {
+				return fmt.Errorf("attribute %s has unknown unit %q", def.Name, def.Unit)
+			}
+		case model.AttributeEnum:
+			if len(def.Values) == 0 {
+				return fmt.Errorf("enum attribute %s needs values", def.Name)
+			}
+		case model.AttributeString, model.AttributeBoolean:
+		default:
+			return fmt.Errorf("attribute %s has unknown type %q", def.Name, def.Type)
+		}
+	}
+	return nil
+}
+
+// Validate checks attribute values against a category's definitions and
+// returns them normalized: numbers in the attribute's unit, booleans as bools
+func Validate(category *model.Category, values map[string]interface{}) (map[string]interface{}, error) {
+	defs := make(map[string]model.AttributeDef, len(category.Attributes))
+	for _, def := range category.Attributes {
+		defs[def.Name] = def
+	}
+
+	normalized := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		def, ok := defs[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not an attribute of %s", name, category.Name)
+		}
+		v, err := parseValue(def, value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", name, err)
+		}
+		normalized[name] = v
+	}
+	for _, def := range category.Attributes {
+		if _, ok := normalized[def.Name]; def.Required && !ok {
+			return nil, fmt.Errorf("attribute %s is required", def.Name)
+		}
+	}
+	return normalized, nil
+}
+
+func parseValue(def model.AttributeDef, value interface{}) (interface{}, error) {
+	switch def.Type {
+	case model.AttributeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("must be a string")
+	case model.AttributeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int, int32, int64:
+			return strconv.ParseFloat(fmt.Sprint(v), 64)
+		case string:
+			return ParseQuantity(v, def.Unit)
+		}
+		return nil, errors.New("must be a number")
+	case model.AttributeEnum:
+		if s, ok := value.(string); ok {
+			for _, allowed := range def.Values {
+				if s == allowed {
+					return s, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(def.Values, ", "))
+	case model.AttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, errors.New("must be true or false")
+	}
+	return nil, fmt.Errorf("unknown type %q", def.Type)
+}
+
+// comparisons are the suffixes filters can put on a number attribute
+var comparisons = []struct{ suffix, operator string }{
+	{"_lte", "$lte"}, {"_gte", "$gte"}, {"_lt", "$lt"}, {"_gt", "$gt"},
+}
+
+// Filter turns attr.<name>=<value> query parameters into a Mongo filter on
+// product attributes. Number attributes also take attr.<name>_lt, _lte, _gt
+// and _gte, with values in any unit of the same kind, e.g. attr.weight_lt=2kg.
+// Filtering on an attribute in conflicting fails, other filters still apply.
+func Filter(defs map[string]model.AttributeDef, conflicting map[string]bool, query url.Values) (bson.M, error) {
+	filter := bson.M{}
+	for key, values := range query {
+		if !strings.HasPrefix(key, "attr.") || len(values) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(key, "attr.")
+		operator := ""
+		if _, ok := defs[name]; !ok && !conflicting[name] {
+			for _, c := range comparisons {
+				if strings.HasSuffix(name, c.suffix) {
+					name, operator = strings.TrimSuffix(name, c.suffix), c.operator
+					break
+				}
+			}
+		}
+		def, ok := defs[name]
+		if conflicting[name] {
+			return nil, fmt.Errorf("attribute %s differs between categories, filter by category", name)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %s", name)
+		}
+		if operator != "" && def.Type != model.AttributeNumber {
+			return nil, fmt.Errorf("attribute %s is not a number", name)
+		}
+
+		value, err := parseValue(def, values[0])
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", name, err)
+		}
+		field := "attributes." + name
+		if operator == "" {
+			filter[field] = value
+			continue
+		}
+		condition, ok := filter[field].(bson.M)
+		if !ok {
+			condition = bson.M{}
+			filter[field] = condition
+		}
+		condition[operator] = value
+	}
+	return filter, nil
+}
@@ -0,0 +1,123 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"product-service/db"
+	"product-service/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrUnknownCategory = errors.New("unknown category")
+
+// ValidationError is returned when attribute values don't match the schema
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+// Init creates the unique index on category names
+func Init() error {
+	_, err := db.MI.DB.Collection("categories").Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Find returns the category with the given name
+func Find(ctx context.Context, name string) (*model.Category, error) {
+	var category model.Category
+	err := db.MI.DB.Collection("categories").FindOne(ctx, bson.M{"name": name}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUnknownCategory
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// All returns every category by name
+func All(ctx context.Context) ([]model.Category, error) {
+	cursor, err := db.MI.DB.Collection("categories").Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := []model.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// Definitions returns the attribute definitions filters are checked against:
+// those of the category, or of every category when none is given. Attributes
+// defined differently by two categories are returned apart as conflicting,
+// since they can only be filtered on within a category.
+func Definitions(ctx context.Context, categoryName string) (map[string]model.AttributeDef, map[string]bool, error) {
+	var categories []model.Category
+	if categoryName != "" {
+		category, err := Find(ctx, categoryName)
+		if err != nil {
+			return nil, nil, err
+		}
+		categories = []model.Category{*category}
+	} else {
+		var err error
+		if categories, err = All(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	defs := make(map[string]model.AttributeDef)
+	conflicting := make(map[string]bool)
+	for _, category := range categories {
+		for _, def := range category.Attributes {
+			if conflicting[def.Name] {
+				continue
+			}
+			if existing, ok := defs[def.Name]; ok && (existing.Type != def.Type || existing.Unit != def.Unit) {
+				delete(defs, def.Name)
+				conflicting[def.Name] = true
+				continue
+			}
+			defs[def.Name] = def
+		}
+	}
+	return defs, conflicting, nil
+}
+
+// ValidateProduct checks a product's attributes against its category and
+// normalizes them in place. Products without attributes need no category
+// schema; products with attributes must belong to a known category.
+func ValidateProduct(ctx context.Context, product *model.Product) error {
+	if product.Category == "" {
+		if len(product.Attributes) > 0 {
+			return &ValidationError{errors.New("attributes need a category")}
+		}
+		return nil
+	}
+	category, err := Find(ctx, product.Category)
+	if err == ErrUnknownCategory && len(product.Attributes) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	attributes, err := Validate(category, product.Attributes)
+	if err != nil {
+		return &ValidationError{err}
+	}
+	if len(attributes) == 0 {
+		attributes = nil
+	}
+	product.Attributes = attributes
+	return nil
+}
@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type unit struct {
+	kind   string
+	factor float64
+}
+
+// units maps each unit to its kind and its size in the base unit of the kind
+var units = map[string]unit{
+	"mg": {"mass", 0.001}, "g": {"mass", 1}, "kg": {"mass", 1000},
+	"oz": {"mass", 28.349523125}, "lb": {"mass", 453.59237},
+	"mm": {"length", 0.001}, "cm": {"length", 0.01}, "m": {"length", 1}, "km": {"length", 1000},
+	"in": {"length", 0.0254}, "ft": {"length", 0.3048},
+	"ml": {"volume", 0.001}, "l": {"volume", 1},
+	"w": {"power", 1}, "kw": {"power", 1000},
+	"mah": {"charge", 1}, "ah": {"charge", 1000},
+}
+
+var quantityPattern = regexp.MustCompile(`^\s*(-?[0-9]*\.?[0-9]+)\s*([a-zA-Z]*)\s*$`)
+
+// KnownUnit reports whether quantities can be given in the unit
+func KnownUnit(name string) bool {
+	_, ok := units[strings.ToLower(name)]
+	return ok
+}
+
+// ParseQuantity reads a value such as "500g" or "1.5" and returns it in
+// target. A bare number is taken to already be in target.
+func ParseQuantity(value, target string) (float64, error) {
+	m := quantityPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid quantity %q", value)
+	}
+	amount, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q", value)
+	}
+	from := strings.ToLower(m[2])
+	if from == "" || strings.EqualFold(from, target) {
+		return amount, nil
+	}
+
+	src, ok := units[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", m[2])
+	}
+	dst, ok := units[strings.ToLower(target)]
+	if !ok || src.kind != dst.kind {
+		return 0, fmt.Errorf("cannot convert %s to %s", m[2], target)
+	}
+	return amount * src.factor / dst.factor, nil
+}
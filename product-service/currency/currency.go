@@ -0,0 +1,96 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"product-service/model"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCurrency = errors.New("invalid currency code")
+
+// minorUnits lists the currencies that do not use two decimal places
+var minorUnits = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// Base returns the currency products are priced in unless they say
+// otherwise, from the BASE_CURRENCY environment variable (default USD)
+func Base() string {
+	if base := os.Getenv("BASE_CURRENCY"); base != "" {
+		return strings.ToUpper(base)
+	}
+	return "USD"
+}
+
+// Normalize upper-cases a currency code and checks it looks like ISO 4217
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalidCurrency
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", ErrInvalidCurrency
+		}
+	}
+	return code, nil
+}
+
+// Exponent returns the number of decimal places of the currency's minor unit
+func Exponent(code string) int {
+	if exp, ok := minorUnits[code]; ok {
+		return exp
+	}
+	return 2
+}
+
+// FromMajor converts a decimal amount such as 19.99 to minor units
+func FromMajor(amount float64, code string) int64 {
+	return int64(math.Round(amount * math.Pow10(Exponent(code))))
+}
+
+// Parse reads a decimal string such as "19.99" as an amount of the currency
+func Parse(value, code string) (model.Money, error) {
+	code, err := Normalize(code)
+	if err != nil {
+		return model.Money{}, err
+	}
+	value = strings.TrimSpace(value)
+	whole, frac, _ := strings.Cut(value, ".")
+	exp := Exponent(code)
+	if len(frac) > exp {
+		return model.Money{}, fmt.Errorf("%s has at most %d decimal places", code, exp)
+	}
+	negative := strings.HasPrefix(whole, "-")
+	digits := strings.TrimPrefix(whole, "-") + frac + strings.Repeat("0", exp-len(frac))
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || whole == "" || whole == "-" {
+		return model.Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return model.Money{Amount: amount, Currency: code}, nil
+}
+
+// Format writes an amount as a decimal string such as "19.99"
+func Format(m model.Money) string {
+	exp := Exponent(m.Currency)
+	if exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
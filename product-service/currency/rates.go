@@ -0,0 +1,92 @@
+package currency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"product-service/model"
+	"sync"
+)
+
+var ErrNoRate = errors.New("no exchange rate for currency")
+
+// RateTable holds how many units of each currency one unit of Base buys
+type RateTable struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+var (
+	ratesMu sync.RWMutex
+	rates   = RateTable{Base: "USD", Rates: map[string]float64{}}
+)
+
+// LoadRates replaces the exchange-rate table with the JSON file at path, e.g.
+// {"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79, "JPY": 149.5}}
+func LoadRates(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var table RateTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return fmt.Errorf("error parsing rates file: %v", err)
+	}
+	if table.Base, err = Normalize(table.Base); err != nil {
+		return fmt.Errorf("invalid base currency in rates file: %v", err)
+	}
+
+	normalized := make(map[string]float64, len(table.Rates))
+	for raw, rate := range table.Rates {
+		code, err := Normalize(raw)
+		if err != nil || rate <= 0 {
+			return fmt.Errorf("invalid rate for %s", raw)
+		}
+		normalized[code] = rate
+	}
+	normalized[table.Base] = 1
+	table.Rates = normalized
+
+	ratesMu.Lock()
+	rates = table
+	ratesMu.Unlock()
+	return nil
+}
+
+// Rates returns the exchange-rate table in use
+func Rates() RateTable {
+	ratesMu.RLock()
+	defer ratesMu.RUnlock()
+	return rates
+}
+
+// Convert converts an amount to another currency through the rate table
+func Convert(m model.Money, to string) (model.Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	table := Rates()
+	rate := func(code string) (float64, error) {
+		if code == table.Base {
+			return 1, nil
+		}
+		if r, ok := table.Rates[code]; ok {
+			return r, nil
+		}
+		return 0, fmt.Errorf("%w %s", ErrNoRate, code)
+	}
+	fromRate, err := rate(m.Currency)
+	if err != nil {
+		return model.Money{}, err
+	}
+	toRate, err := rate(to)
+	if err != nil {
+		return model.Money{}, err
+	}
+
+	major := float64(m.Amount) / math.Pow10(Exponent(m.Currency))
+	converted := major / fromRate * toRate
+	return model.Money{Amount: FromMajor(converted, to), Currency: to}, nil
+}
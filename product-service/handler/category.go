@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"product-service/catalog"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateCategory defines a category and the attributes of its products
+func CreateCategory(c *gin.Context) {
+	var category model.Category
+	if err := c.ShouldBindJSON(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := catalog.ValidateDefinition(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if category.Attributes == nil {
+		category.Attributes = []model.AttributeDef{}
+	}
+	category.UpdatedAt = time.Now().UTC()
+
+	if _, err := db.MI.DB.Collection("categories").InsertOne(context.TODO(), category); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "category already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+// GetCategories lists every category with its attribute schema
+func GetCategories(c *gin.Context) {
+	categories, err := catalog.All(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// GetCategory retrieves a category with its attribute schema
+func GetCategory(c *gin.Context) {
+	category, err := catalog.Find(context.TODO(), c.Param("name"))
+	if err != nil {
+		if err == catalog.ErrUnknownCategory {
+			c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// UpdateCategory replaces the description and attribute schema of a
+// category. Existing products are checked against the new schema the next
+// time their attributes are set.
+func UpdateCategory(c *gin.Context) {
+	var input model.Category
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = c.Param("name")
+	if err := catalog.ValidateDefinition(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Attributes == nil {
+		input.Attributes = []model.AttributeDef{}
+	}
+	input.UpdatedAt = time.Now().UTC()
+
+	result, err := db.MI.DB.Collection("categories").UpdateOne(context.TODO(),
+		bson.M{"name": input.Name},
+		bson.M{"$set": bson.M{
+			"description": input.Description,
+			"attributes":  input.Attributes,
+			"updated_at":  input.UpdatedAt,
+		}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating category"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, input)
+}
+
+// SetProductAttributes replaces the category and attribute values of a
+// product, validated against the category's schema
+func SetProductAttributes(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Category   string                 `json:"category" binding:"required"`
+		Attributes map[string]interface{} `json:"attributes"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product := model.Product{Category: input.Category, Attributes: input.Attributes}
+	if err := catalog.ValidateProduct(context.TODO(), &product); err != nil {
+		attributeError(c, err)
+		return
+	}
+
+	result, err := db.MI.DB.Collection("products").UpdateOne(context.TODO(),
+		bson.M{"name": productName},
+		bson.M{"$set": bson.M{"category": product.Category, "attributes": product.Attributes}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating product"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	utils.InvalidateProduct(productName)
+
+	c.JSON(http.StatusOK, gin.H{"message": "product attributes updated", "category": product.Category, "attributes": product.Attributes})
+}
+
+func attributeError(c *gin.Context, err error) {
+	var invalid *catalog.ValidationError
+	if errors.Is(err, catalog.ErrUnknownCategory) || errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "error validating attributes"})
+}
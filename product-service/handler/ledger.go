@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"product-service/inventory"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLedger returns the inventory ledger of a product, newest entries first
+func GetLedger(c *gin.Context) {
+	productName := c.Param("name")
+	limit, err := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	entries, err := inventory.History(context.TODO(), productName, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// ReconcileInventory recomputes balances from the ledger and reports every
+// stored quantity that does not match
+func ReconcileInventory(c *gin.Context) {
+	discrepancies, err := inventory.Reconcile(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error reconciling inventory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"discrepancies": discrepancies})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"product-service/db"
+	"product-service/inventory"
+	"product-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetReorderThreshold sets the quantity at or below which a product is
+// reported as low on stock
+func SetReorderThreshold(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		ReorderThreshold *int `json:"reorder_threshold" binding:"required,gte=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := db.MI.DB.Collection("products").UpdateOne(context.TODO(),
+		bson.M{"name": productName},
+		bson.M{"$set": bson.M{"reorder_threshold": *input.ReorderThreshold}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	utils.InvalidateProduct(productName)
+
+	c.JSON(http.StatusOK, gin.H{"message": "reorder threshold updated"})
+}
+
+// GetLowStockProducts reports every product at or below its reorder threshold
+func GetLowStockProducts(c *gin.Context) {
+	products, err := inventory.LowStock(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching products"})
+		return
+	}
+
+	report := make([]gin.H, 0, len(products))
+	for _, p := range products {
+		report = append(report, gin.H{
+			"name":              p.ProductName,
+			"quantity":          p.Quantity,
+			"reorder_threshold": p.ReorderThreshold,
+			"shortfall":         p.ReorderThreshold - p.Quantity,
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
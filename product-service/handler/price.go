@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"product-service/currency"
+	"product-service/model"
+	"product-service/pricing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SetPrice changes the regular price of a product, immediately or at effective_at
+func SetPrice(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Price       model.Money `json:"price" binding:"required"`
+		EffectiveAt *time.Time  `json:"effective_at"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePrice(&input.Price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.EffectiveAt == nil || !input.EffectiveAt.After(time.Now()) {
+		err := pricing.SetRegularPrice(context.TODO(), productName, input.Price, pricing.ReasonManual, requestActor(c), nil)
+		if err != nil {
+			priceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "price updated"})
+		return
+	}
+
+	change, err := pricing.Schedule(context.TODO(), model.PriceChange{
+		ProductName: productName,
+		Kind:        model.PriceChangeRegular,
+		Price:       input.Price,
+		EffectiveAt: input.EffectiveAt.UTC(),
+		Actor:       requestActor(c),
+	})
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "price change scheduled", "data": change})
+}
+
+// ScheduleSale schedules a sale price for a product between starts_at and ends_at
+func ScheduleSale(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Price    model.Money `json:"price" binding:"required"`
+		StartsAt time.Time   `json:"starts_at" binding:"required"`
+		EndsAt   time.Time   `json:"ends_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePrice(&input.Price); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.EndsAt.After(input.StartsAt) || !input.EndsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be in the future and after starts_at"})
+		return
+	}
+
+	endsAt := input.EndsAt.UTC()
+	change, err := pricing.Schedule(context.TODO(), model.PriceChange{
+		ProductName: productName,
+		Kind:        model.PriceChangeSale,
+		Price:       input.Price,
+		EffectiveAt: input.StartsAt.UTC(),
+		EndsAt:      &endsAt,
+		Actor:       requestActor(c),
+	})
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "sale scheduled", "data": change})
+}
+
+// SetPriceList replaces the explicit prices of a product in other currencies.
+// Currencies without an entry are converted from the product's own price.
+func SetPriceList(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Prices []model.Money `json:"prices"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range input.Prices {
+		if err := validatePrice(&input.Prices[i]); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if seen[input.Prices[i].Currency] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate price for " + input.Prices[i].Currency})
+			return
+		}
+		seen[input.Prices[i].Currency] = true
+	}
+
+	if err := pricing.SetPriceList(context.TODO(), productName, input.Prices, requestActor(c)); err != nil {
+		priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "price list updated", "data": input.Prices})
+}
+
+// GetPrices returns the current, scheduled and past prices of a product
+func GetPrices(c *gin.Context) {
+	productName := c.Param("name")
+
+	pending, err := pricing.Pending(context.TODO(), productName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching price changes"})
+		return
+	}
+	history, err := pricing.History(context.TODO(), productName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled": pending, "history": history})
+}
+
+// CancelPriceChange withdraws a scheduled price change or ends a running sale
+func CancelPriceChange(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid price change id"})
+		return
+	}
+
+	change, err := pricing.Cancel(context.TODO(), id)
+	if err != nil {
+		priceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "price change cancelled", "data": change})
+}
+
+// validatePrice checks an amount is positive and normalizes its currency,
+// which defaults to the base currency
+func validatePrice(price *model.Money) error {
+	if price.Amount <= 0 {
+		return errors.New("price amount must be greater than 0")
+	}
+	if price.Currency == "" {
+		price.Currency = currency.Base()
+	}
+	code, err := currency.Normalize(price.Currency)
+	if err != nil {
+		return err
+	}
+	price.Currency = code
+	return nil
+}
+
+// localize converts the prices of products to the currency query parameter,
+// writing the error response and returning false when it can't
+func localize(c *gin.Context, products ...*model.Product) bool {
+	code := c.Query("currency")
+	if code == "" {
+		return true
+	}
+	code, err := currency.Normalize(code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	for _, product := range products {
+		if err := pricing.Localize(product, code); err != nil {
+			if errors.Is(err, currency.ErrNoRate) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+func priceError(c *gin.Context, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, pricing.ErrOverlappingSale), errors.Is(err, pricing.ErrNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, pricing.ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,428 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"product-service/catalog"
+	"product-service/currency"
+	"product-service/db"
+	"product-service/inventory"
+	"product-service/model"
+	"product-service/pricing"
+	"product-service/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+
+	maxImportBytes = 10 << 20
+)
+
+var csvColumns = []string{"name", "sku", "description", "category", "price", "currency", "quantity", "reorder_threshold"}
+
+type importRow struct {
+	Line    int
+	Product model.Product
+	Err     error
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error"`
+}
+
+// ImportProducts upserts products from a CSV or NDJSON body, matching
+// existing products by SKU and then by name. Each row replaces the catalogue
+// fields of an existing product; its quantity only applies to new products,
+// since stock changes go through the inventory endpoints and the ledger.
+// With dry_run=true the rows are validated and counted but nothing is written.
+func ImportProducts(c *gin.Context) {
+	format := importFormat(c)
+	if format == "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "body must be text/csv or application/x-ndjson"})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	for _, indexModel := range []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sku", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"sku": bson.M{"$type": "string"}})},
+	} {
+		db.MI.DB.Collection("products").Indexes().CreateOne(context.TODO(), indexModel)
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var rows []importRow
+	var err error
+	if format == formatCSV {
+		rows, err = readCSVRows(body)
+	} else {
+		rows, err = readNDJSONRows(body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, updated := 0, 0
+	rowErrors := []importError{}
+	seen := make(map[string]int)
+	for _, row := range rows {
+		p := row.Product
+		fail := func(err error) {
+			rowErrors = append(rowErrors, importError{Line: row.Line, Name: p.ProductName, Error: err.Error()})
+		}
+		if row.Err != nil {
+			fail(row.Err)
+			continue
+		}
+		if err := validateImportRow(&p); err != nil {
+			fail(err)
+			continue
+		}
+		if line, ok := seen[p.ProductName]; ok {
+			fail(fmt.Errorf("duplicate of line %d", line))
+			continue
+		}
+		seen[p.ProductName] = row.Line
+
+		isNew, err := upsertProduct(context.TODO(), p, dryRun, requestActor(c))
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	if !dryRun && created+updated > 0 {
+		utils.EmitEvents("Products Imported")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": dryRun,
+		"created": created,
+		"updated": updated,
+		"failed":  len(rowErrors),
+		"errors":  rowErrors,
+	})
+}
+
+// ExportProducts streams the whole catalogue as CSV or NDJSON. CSV has no
+// columns for a bundle's components, so bundles are only exported as NDJSON.
+func ExportProducts(c *gin.Context) {
+	format := c.DefaultQuery("format", formatCSV)
+	if format != formatCSV && format != formatNDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+
+	filter := bson.M{"deleted_at": nil}
+	if format == formatCSV {
+		filter["type"] = bson.M{"$ne": model.ProductTypeBundle}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := db.MI.DB.Collection("products").Find(context.Background(), filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching products"})
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	if format == formatCSV {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", `attachment; filename="products.csv"`)
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="products.ndjson"`)
+	}
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == formatCSV {
+		csvWriter.Write(csvColumns)
+	}
+
+	for count := 1; cursor.Next(context.Background()); count++ {
+		var p model.Product
+		if err := cursor.Decode(&p); err != nil {
+			log.Printf("Error decoding product for export: %v", err)
+			continue
+		}
+		if format == formatCSV {
+			err = csvWriter.Write([]string{
+				p.ProductName,
+				p.SKU,
+				p.Description,
+				p.Category,
+				currency.Format(p.Price),
+				p.Price.Currency,
+				strconv.Itoa(p.Quantity),
+				strconv.Itoa(p.ReorderThreshold),
+			})
+		} else {
+			err = encoder.Encode(p)
+		}
+		if err != nil {
+			// The client has gone away, there is nobody left to report to
+			log.Printf("Error writing product export: %v", err)
+			return
+		}
+
+		// Flush regularly so large catalogues are streamed rather than buffered
+		if count%100 == 0 {
+			csvWriter.Flush()
+			c.Writer.Flush()
+		}
+	}
+	csvWriter.Flush()
+	c.Writer.Flush()
+}
+
+func importFormat(c *gin.Context) string {
+	switch c.Query("format") {
+	case formatCSV:
+		return formatCSV
+	case formatNDJSON:
+		return formatNDJSON
+	}
+	switch c.ContentType() {
+	case "text/csv":
+		return formatCSV
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		return formatNDJSON
+	}
+	return ""
+}
+
+func readCSVRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, importRow{Line: parseErr.Line, Err: parseErr.Err})
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{Line: line}
+		row.Product, row.Err = productFromFields(field)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func productFromFields(field func(string) string) (model.Product, error) {
+	p := model.Product{
+		ProductName: field("name"),
+		SKU:         field("sku"),
+		Description: field("description"),
+		Category:    field("category"),
+	}
+	// CSV prices are decimal amounts, in the base currency unless given
+	code := field("currency")
+	if code == "" {
+		code = currency.Base()
+	}
+	var err error
+	if p.Price, err = currency.Parse(field("price"), code); err != nil {
+		return p, fmt.Errorf("invalid price %q: %v", field("price"), err)
+	}
+	if v := field("quantity"); v != "" {
+		if p.Quantity, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("invalid quantity %q", v)
+		}
+	}
+	if v := field("reorder_threshold"); v != "" {
+		if p.ReorderThreshold, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("invalid reorder_threshold %q", v)
+		}
+	}
+	return p, nil
+}
+
+func readNDJSONRows(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := importRow{Line: line}
+		if err := json.Unmarshal([]byte(text), &row.Product); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading NDJSON body: %v", err)
+	}
+	return rows, nil
+}
+
+func validateImportRow(p *model.Product) error {
+	if p.ProductName == "" {
+		return errors.New("name is required")
+	}
+	if err := validatePrice(&p.Price); err != nil {
+		return err
+	}
+	for i := range p.PriceList {
+		if err := validatePrice(&p.PriceList[i]); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.Quantity < 0:
+		return errors.New("quantity must not be negative")
+	case p.ReorderThreshold < 0:
+		return errors.New("reorder_threshold must not be negative")
+	}
+	return nil
+}
+
+// upsertProduct creates p or replaces the catalogue fields of the product it
+// matches, reporting whether it was new
+func upsertProduct(ctx context.Context, p model.Product, dryRun bool, actor string) (bool, error) {
+	var existing model.Product
+	var err error
+	if p.SKU != "" {
+		err = db.MI.DB.Collection("products").FindOne(ctx, bson.M{"sku": p.SKU}).Decode(&existing)
+		if err == nil && existing.ProductName != p.ProductName {
+			return false, fmt.Errorf("sku %s already belongs to %s", p.SKU, existing.ProductName)
+		}
+	}
+	if p.SKU == "" || err == mongo.ErrNoDocuments {
+		err = db.MI.DB.Collection("products").FindOne(ctx, bson.M{"name": p.ProductName}).Decode(&existing)
+	}
+
+	if err == mongo.ErrNoDocuments {
+		if err := prepareType(ctx, &p); err != nil {
+			return false, err
+		}
+		if err := catalog.ValidateProduct(ctx, &p); err != nil {
+			return false, err
+		}
+		if dryRun {
+			return true, nil
+		}
+		p.ID = ""
+		p.Stock = nil
+		p.Images = nil
+		p.Rating = model.RatingSummary{}
+		p.ActiveSale = nil
+		p.RegularPrice = p.Price
+		if _, err := db.MI.DB.Collection("products").InsertOne(ctx, p); err != nil {
+			return false, fmt.Errorf("error creating product: %v", err)
+		}
+		utils.InvalidateProduct(p.ProductName)
+		if p.Type == model.ProductTypeBundle {
+			return true, nil
+		}
+		if err := inventory.SeedStock(ctx, p.ProductName, actor); err != nil {
+			log.Printf("Error seeding stock for %s: %v", p.ProductName, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error fetching product: %v", err)
+	}
+	if existing.DeletedAt != nil {
+		return false, fmt.Errorf("%s is archived, restore it before importing", existing.ProductName)
+	}
+	// Import doesn't turn products into bundles or back. A bundle's
+	// components and pricing are left as they are.
+	if p.Type != existing.Type {
+		return false, fmt.Errorf("type of %s can't be changed by import", existing.ProductName)
+	}
+	// Checked before anything is written, so a row with a bad price leaves
+	// the product untouched
+	if p.Price.Currency != existing.Price.Currency {
+		return false, pricing.ErrCurrencyMismatch
+	}
+
+	// Rows without attributes, such as CSV rows, keep the product's own
+	if len(p.Attributes) == 0 && p.Category == existing.Category {
+		p.Attributes = existing.Attributes
+	}
+	if err := catalog.ValidateProduct(ctx, &p); err != nil {
+		return false, err
+	}
+	if dryRun {
+		return false, nil
+	}
+	fields := bson.M{
+		"description":       p.Description,
+		"category":          p.Category,
+		"attributes":        p.Attributes,
+		"reorder_threshold": p.ReorderThreshold,
+	}
+	if p.SKU != "" {
+		fields["sku"] = p.SKU
+	}
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx, bson.M{"name": existing.ProductName}, bson.M{"$set": fields})
+	if err != nil {
+		return false, fmt.Errorf("error updating product: %v", err)
+	}
+	utils.InvalidateProduct(existing.ProductName)
+	// Prices go through pricing so the change is recorded and announced
+	err = pricing.SetRegularPrice(ctx, existing.ProductName, p.Price, pricing.ReasonImport, actor, nil)
+	if err != nil {
+		return false, fmt.Errorf("error updating price: %v", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"product-service/db"
+	"product-service/media"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxImageBytes  = 5 << 20
+	maxUploadBytes = 8 * maxImageBytes
+)
+
+// maxImageAttempts bounds how often a change to a product's images is
+// retried when other changes keep getting in first
+const maxImageAttempts = 5
+
+var errImageNotFound = errors.New("image not found")
+
+type imageUploadError struct {
+	status int
+	err    error
+}
+
+// UploadProductImages stores the images sent in the multipart "image" field,
+// generates their thumbnails and appends them to the product. The first image
+// of a product becomes its primary image, as does an upload with primary=true.
+func UploadProductImages(c *gin.Context) {
+	productName := c.Param("name")
+	product, ok := findProductForImages(c, productName)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid multipart upload: %v", err)})
+		return
+	}
+	files := form.File["image"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no image uploaded in the image field"})
+		return
+	}
+
+	uploaded := make([]model.ProductImage, 0, len(files))
+	discard := func() {
+		for _, u := range uploaded {
+			deleteStoredImage(c.Request.Context(), product, u.ID)
+		}
+	}
+	for _, file := range files {
+		image, uploadErr := storeImage(c.Request.Context(), product, file)
+		if uploadErr != nil {
+			// Keep the upload all or nothing
+			discard()
+			c.JSON(uploadErr.status, gin.H{"error": fmt.Sprintf("%s: %v", file.Filename, uploadErr.err)})
+			return
+		}
+		uploaded = append(uploaded, image)
+	}
+
+	primary := c.PostForm("primary") == "true"
+	images, ok := updateImages(c, productName, func(images []model.ProductImage) ([]model.ProductImage, error) {
+		for _, image := range uploaded {
+			image.Position = len(images)
+			images = append(images, image)
+		}
+		if primary || !hasPrimary(images) {
+			setPrimary(images, uploaded[0].ID)
+		}
+		return images, nil
+	})
+	if !ok {
+		discard()
+		return
+	}
+	utils.EmitEvents("Product Images Uploaded")
+
+	c.JSON(http.StatusOK, gin.H{"message": "images uploaded", "data": images})
+}
+
+// DeleteProductImage removes an image and its thumbnails from a product
+func DeleteProductImage(c *gin.Context) {
+	productName := c.Param("name")
+	imageID := c.Param("imageId")
+	product, ok := findProductForImages(c, productName)
+	if !ok {
+		return
+	}
+
+	images, ok := updateImages(c, productName, func(current []model.ProductImage) ([]model.ProductImage, error) {
+		images := make([]model.ProductImage, 0, len(current))
+		wasPrimary := false
+		for _, image := range current {
+			if image.ID == imageID {
+				wasPrimary = image.Primary
+				continue
+			}
+			image.Position = len(images)
+			images = append(images, image)
+		}
+		if len(images) == len(current) {
+			return nil, errImageNotFound
+		}
+		if wasPrimary && len(images) > 0 {
+			images[0].Primary = true
+		}
+		return images, nil
+	})
+	if !ok {
+		return
+	}
+	deleteStoredImage(c.Request.Context(), product, imageID)
+	utils.EmitEvents("Product Image Deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "image deleted", "data": images})
+}
+
+// ReorderProductImages sets the display order of a product's images. The
+// body must list every image ID exactly once.
+func ReorderProductImages(c *gin.Context) {
+	productName := c.Param("name")
+	var input struct {
+		Order []string `json:"order" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	errBadOrder := errors.New("order must list every image exactly once")
+	images, ok := updateImages(c, productName, func(current []model.ProductImage) ([]model.ProductImage, error) {
+		byID := make(map[string]model.ProductImage, len(current))
+		for _, image := range current {
+			byID[image.ID] = image
+		}
+		if len(input.Order) != len(byID) {
+			return nil, errBadOrder
+		}
+		images := make([]model.ProductImage, 0, len(input.Order))
+		for i, id := range input.Order {
+			image, found := byID[id]
+			if !found {
+				return nil, errBadOrder
+			}
+			delete(byID, id)
+			image.Position = i
+			images = append(images, image)
+		}
+		return images, nil
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "images reordered", "data": images})
+}
+
+// SetPrimaryImage marks one image as the product's primary image
+func SetPrimaryImage(c *gin.Context) {
+	productName := c.Param("name")
+	imageID := c.Param("imageId")
+
+	images, ok := updateImages(c, productName, func(images []model.ProductImage) ([]model.ProductImage, error) {
+		if !setPrimary(images, imageID) {
+			return nil, errImageNotFound
+		}
+		return images, nil
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "primary image updated", "data": images})
+}
+
+func findProductForImages(c *gin.Context, productName string) (*model.Product, bool) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOne(context.TODO(), bson.M{"name": productName}).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching product"})
+		return nil, false
+	}
+	return &product, true
+}
+
+// updateImages applies change to the product's current images and saves the
+// result, only if nobody changed them since they were read. Otherwise it
+// reads them again and retries, so concurrent changes are all kept. Errors
+// from change are client errors: errImageNotFound is 404, others 400.
+func updateImages(c *gin.Context, productName string, change func([]model.ProductImage) ([]model.ProductImage, error)) ([]model.ProductImage, bool) {
+	for attempt := 0; attempt < maxImageAttempts; attempt++ {
+		product, ok := findProductForImages(c, productName)
+		if !ok {
+			return nil, false
+		}
+		images, err := change(product.Images)
+		if err == errImageNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+
+		filter := bson.M{"name": productName, "images_version": product.ImagesVersion}
+		if product.ImagesVersion == 0 {
+			// Images saved before versions were kept
+			filter["images_version"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		result, err := db.MI.DB.Collection("products").UpdateOne(context.TODO(), filter, bson.M{
+			"$set": bson.M{"images": images},
+			"$inc": bson.M{"images_version": 1},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error saving images"})
+			return nil, false
+		}
+		if result.MatchedCount > 0 {
+			utils.InvalidateProduct(productName)
+			return images, true
+		}
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "images are being changed by another request, try again"})
+	return nil, false
+}
+
+// storeImage validates one uploaded file and writes it and its thumbnails to storage
+func storeImage(ctx context.Context, product *model.Product, file *multipart.FileHeader) (model.ProductImage, *imageUploadError) {
+	if file.Size > maxImageBytes {
+		return model.ProductImage{}, &imageUploadError{http.StatusRequestEntityTooLarge, fmt.Errorf("image is larger than %d bytes", maxImageBytes)}
+	}
+	f, err := file.Open()
+	if err != nil {
+		return model.ProductImage{}, &imageUploadError{http.StatusBadRequest, err}
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImageBytes+1))
+	if err != nil {
+		return model.ProductImage{}, &imageUploadError{http.StatusBadRequest, err}
+	}
+	if len(data) > maxImageBytes {
+		return model.ProductImage{}, &imageUploadError{http.StatusRequestEntityTooLarge, fmt.Errorf("image is larger than %d bytes", maxImageBytes)}
+	}
+
+	// Trust the bytes rather than the content type the client claims
+	contentType := http.DetectContentType(data)
+	ext, allowed := media.AllowedTypes[contentType]
+	if !allowed {
+		return model.ProductImage{}, &imageUploadError{http.StatusUnsupportedMediaType, fmt.Errorf("content type %s is not allowed", contentType)}
+	}
+	decoded, err := media.Decode(data)
+	if err != nil {
+		return model.ProductImage{}, &imageUploadError{http.StatusUnsupportedMediaType, err}
+	}
+
+	image := model.ProductImage{
+		ID:          primitive.NewObjectID().Hex(),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now().UTC(),
+	}
+	prefix := imagePrefix(product, image.ID)
+	key := prefix + "/original." + ext
+	if err := media.Store.Put(ctx, key, bytes.NewReader(data), contentType); err != nil {
+		return model.ProductImage{}, &imageUploadError{http.StatusInternalServerError, errors.New("error storing image")}
+	}
+	image.URL = media.Store.URL(key)
+
+	for _, size := range media.ThumbnailSizes {
+		thumb, thumbType, err := media.Encode(media.Thumbnail(decoded, size.Pixels), contentType)
+		if err == nil {
+			key := fmt.Sprintf("%s/%s.%s", prefix, size.Name, media.AllowedTypes[thumbType])
+			err = media.Store.Put(ctx, key, bytes.NewReader(thumb), thumbType)
+			image.Thumbnails = append(image.Thumbnails, model.Thumbnail{Size: size.Name, URL: media.Store.URL(key)})
+		}
+		if err != nil {
+			deleteStoredImage(ctx, product, image.ID)
+			return model.ProductImage{}, &imageUploadError{http.StatusInternalServerError, errors.New("error generating thumbnails")}
+		}
+	}
+	return image, nil
+}
+
+func deleteStoredImage(ctx context.Context, product *model.Product, imageID string) {
+	if err := media.Store.Delete(ctx, imagePrefix(product, imageID)); err != nil {
+		log.Printf("Error deleting image %s of %s: %v", imageID, product.ProductName, err)
+	}
+}
+
+// imagePrefix keys images by product ID, since names can contain characters
+// that are awkward in paths and object keys
+func imagePrefix(product *model.Product, imageID string) string {
+	return product.ID + "/" + imageID
+}
+
+func hasPrimary(images []model.ProductImage) bool {
+	for _, image := range images {
+		if image.Primary {
+			return true
+		}
+	}
+	return false
+}
+
+func setPrimary(images []model.ProductImage, imageID string) bool {
+	found := false
+	for i := range images {
+		images[i].Primary = images[i].ID == imageID
+		found = found || images[i].Primary
+	}
+	return found
+}
@@ -2,13 +2,18 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"product-service/archive"
+	"product-service/bundle"
+	"product-service/cache"
+	"product-service/catalog"
 	"product-service/db"
+	"product-service/inventory"
 	"product-service/model"
 	"product-service/utils"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -22,70 +27,223 @@ func CreateProduct(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	if err := prepareType(context.TODO(), &product); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePrice(&product.Price); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range product.PriceList {
+		if err := validatePrice(&product.PriceList[i]); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := catalog.ValidateProduct(context.TODO(), &product); err != nil {
+		attributeError(c, err)
+		return
+	}
+	// Images, ratings and sales are only added through their own endpoints
+	product.Images = nil
+	product.Rating = model.RatingSummary{}
+	product.ActiveSale = nil
+	product.RegularPrice = product.Price
+
 	indexModel := mongo.IndexModel{
 		Keys:    bson.D{{Key: "name", Value: 1}}, // 1 for ascending order
 		Options: options.Index().SetUnique(true),
 	}
 	db.MI.DB.Collection("products").Indexes().CreateOne(context.TODO(), indexModel)
 
-	_, err := db.MI.DB.Collection("products").InsertOne(c, product)
+	// The product and its event are written in one transaction
+	err := utils.Outbox.Transact(c, func(ctx context.Context) error {
+		if _, err := db.MI.DB.Collection("products").InsertOne(ctx, product); err != nil {
+			return err
+		}
+		return utils.StageEvents(ctx, "Product Created")
+	})
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error creating product/ Product already exists"})
 		return
 	}
+	// Drop any cached miss for the name
+	utils.InvalidateProduct(product.ProductName)
 
-	utils.EmitEvents("Product Created")
+	// Put the initial quantity into the default warehouse
+	if product.Type != model.ProductTypeBundle {
+		if err := inventory.SeedStock(context.TODO(), product.ProductName, requestActor(c)); err != nil {
+			log.Printf("Error seeding stock for %s: %v", product.ProductName, err)
+		}
+	}
 
 	c.JSON(200, gin.H{"message": "Product created successfully", "data": product})
 }
 
+// prepareType checks the type of a new product. Plain products carry no
+// bundle fields, and a bundle's components are checked since its stock comes
+// from them.
+func prepareType(ctx context.Context, product *model.Product) error {
+	switch product.Type {
+	case model.ProductTypeBundle:
+		return bundle.Prepare(ctx, product)
+	case "":
+		product.Components = nil
+		product.BundlePricing = nil
+		return nil
+	}
+	return errors.New("type must be empty or bundle")
+}
+
+// UpdateProduct adjusts the inventory of a product. Positive quantities are
+// added to a warehouse (the default one unless warehouse_id is given).
+// Negative quantities are taken from warehouse_id, or reserved across
+// warehouses using the allocation strategy when no warehouse is given.
+// Every adjustment is written to the inventory ledger with its reason. An
+// adjustment with a reference_id is only applied once for that reference.
+// Adjusting a bundle adjusts each of its components by the bundle quantity
+// times the component quantity, and reserving one reserves all components or
+// none.
 func UpdateProduct(c *gin.Context) {
 	productName := c.Param("name")
 	var updateData struct {
-		Quantity int `json:"quantity"`
+		Quantity    int             `json:"quantity"`
+		WarehouseID string          `json:"warehouse_id"`
+		Strategy    string          `json:"strategy"`
+		Destination *model.Location `json:"destination"`
+		Reason      string          `json:"reason"`
+		ReferenceID string          `json:"reference_id"`
 	}
 	if err := c.BindJSON(&updateData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if updateData.Reason == "" {
+		updateData.Reason = model.ReasonManual
+	}
+	if !inventory.ValidReason(updateData.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be one of order, restock, manual, return"})
+		return
+	}
+	movement := inventory.Movement{
+		Reason:      updateData.Reason,
+		ReferenceID: updateData.ReferenceID,
+		Actor:       requestActor(c),
+	}
 
-	filter := bson.M{"name": productName}
-	update := bson.M{"$inc": bson.M{"quantity": updateData.Quantity}}
-
-	result, err := db.MI.DB.Collection("products").UpdateOne(context.TODO(), filter, update)
+	var target model.Product
+	err := db.MI.DB.Collection("products").FindOne(context.TODO(), bson.M{"name": productName},
+		options.FindOne().SetProjection(bson.M{"name": 1, "type": 1, "components": 1, "deleted_at": 1})).Decode(&target)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching product"})
+		return
+	}
+	if target.DeletedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "product is archived, restore it before changing its stock"})
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+	if target.Type == model.ProductTypeBundle && updateData.Quantity < 0 && updateData.WarehouseID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "bundles are reserved across warehouses, leave out warehouse_id"})
 		return
 	}
+	reserve := updateData.Quantity < 0 && updateData.WarehouseID == ""
+	warehouseID := updateData.WarehouseID
+	if !reserve {
+		if warehouseID == "" {
+			warehouseID = model.DefaultWarehouseID
+		}
+		exists, err := inventory.WarehouseExists(context.TODO(), warehouseID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching warehouse"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "warehouse not found"})
+			return
+		}
+	}
+	strategy := inventory.NewStrategy(updateData.Strategy, updateData.Destination)
+
+	// A change is applied once per reference
+	var allocations []model.Allocation
+	var products []*model.Product
+	err = inventory.Once(context.TODO(), productName, updateData.Quantity, movement, func(ctx context.Context) error {
+		var err error
+		allocations, products, err = changeStock(ctx, &target, updateData.Quantity, warehouseID, reserve, strategy, movement)
+		return err
+	})
+	if errors.Is(err, inventory.ErrAlreadyApplied) {
+		c.JSON(http.StatusOK, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		inventoryError(c, err)
+		return
+	}
+
 	utils.EmitEvents("product_updated")
+	if target.Type == model.ProductTypeBundle {
+		utils.InvalidateProduct(target.ProductName)
+		for i, component := range products {
+			inventory.CheckLowStock(component, updateData.Quantity*target.Components[i].Quantity)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "bundle inventory updated", "allocations": allocations})
+		return
+	}
+	inventory.CheckLowStock(products[0], updateData.Quantity)
 
-	c.JSON(http.StatusOK, gin.H{"message": "product inventory updated"})
+	c.JSON(http.StatusOK, gin.H{"message": "product inventory updated", "allocations": allocations})
 }
 
-func DeleteProduct(c *gin.Context) {
-	productName := c.Param("name")
-	filter := bson.D{{Key: "name", Value: productName}}
+// changeStock reserves or adjusts the stock of a product, or of each
+// component of a bundle, returning the allocations reserved and the updated
+// products
+func changeStock(ctx context.Context, target *model.Product, quantity int, warehouseID string, reserve bool, strategy inventory.Strategy, movement inventory.Movement) ([]model.Allocation, []*model.Product, error) {
+	if target.Type == model.ProductTypeBundle {
+		if reserve {
+			return inventory.ReserveBundle(ctx, target.Components, -quantity, strategy, movement)
+		}
+		components, err := inventory.AdjustBundle(ctx, target.Components, warehouseID, quantity, movement)
+		return nil, components, err
+	}
+	if reserve {
+		allocations, product, err := inventory.Reserve(ctx, target.ProductName, -quantity, strategy, movement)
+		return allocations, []*model.Product{product}, err
+	}
+	product, err := inventory.Adjust(ctx, target.ProductName, warehouseID, quantity, movement)
+	return nil, []*model.Product{product}, err
+}
 
-	find, err := db.MI.DB.Collection("products").Find(context.TODO(), filter)
-	if err != nil {
-		c.JSON(500, gin.H{"error": "Error finding product"})
+func inventoryError(c *gin.Context, err error) {
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
 	}
-	if !find.Next(context.Background()) {
-		c.JSON(404, gin.H{"error": "Product not found"})
+	if errors.Is(err, inventory.ErrInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": "insufficient inventory"})
 		return
 	}
-	_, err = db.MI.DB.Collection("products").DeleteOne(context.TODO(), filter)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// DeleteProduct archives a product. It disappears from listings and can no
+// longer be ordered, but stays resolvable by name for past orders until the
+// purge job removes it.
+func DeleteProduct(c *gin.Context) {
+	productName := c.Param("name")
+
+	_, err := archive.Archive(context.TODO(), productName)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(404, gin.H{"error": "Product not found"})
+			return
+		}
 		c.JSON(500, gin.H{"error": "Error deleting product"})
 		return
 	}
@@ -94,11 +252,57 @@ func DeleteProduct(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "Product deleted successfully"})
 }
 
+// GetArchivedProducts lists the archived products
+func GetArchivedProducts(c *gin.Context) {
+	products, err := archive.Archived(context.TODO())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
+}
+
+// RestoreProduct brings an archived product back into the catalogue
+func RestoreProduct(c *gin.Context) {
+	productName := c.Param("name")
+
+	product, err := archive.Restore(context.TODO(), productName)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "archived product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error restoring product"})
+		return
+	}
+	utils.EmitEvents("Product Restored")
+
+	c.JSON(http.StatusOK, gin.H{"message": "product restored", "data": product})
+}
+
 func GetProducts(c *gin.Context) {
 	var products []model.Product
 
 	// Query the database
-	cursor, err := db.MI.DB.Collection("products").Find(context.Background(), bson.D{})
+	filter := bson.M{}
+	if c.Query("category") != "" || hasAttributeFilter(c) {
+		defs, conflicting, err := catalog.Definitions(context.TODO(), c.Query("category"))
+		if err != nil {
+			attributeError(c, err)
+			return
+		}
+		if filter, err = catalog.Filter(defs, conflicting, c.Request.URL.Query()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if category := c.Query("category"); category != "" {
+			filter["category"] = category
+		}
+	}
+	filter["deleted_at"] = nil
+
+	cursor, err := db.MI.DB.Collection("products").Find(context.Background(), filter)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error fetching products"})
 		return
@@ -107,31 +311,38 @@ func GetProducts(c *gin.Context) {
 	for cursor.Next(context.Background()) {
 		var product model.Product
 		cursor.Decode(&product)
+		if err := bundle.Resolve(context.TODO(), &product); err != nil {
+			log.Printf("Error resolving bundle %s: %v", product.ProductName, err)
+		}
 		products = append(products, product)
 	}
 
+	for i := range products {
+		if !localize(c, &products[i]) {
+			return
+		}
+	}
 	c.JSON(200, products)
 }
 
-func GetProduct(c *gin.Context) {
-	productName := c.Param("name")
-	var product model.Product
-
-	// Check Redis cache first
-	val, err := utils.RDB.Get(context.Background(), "product:"+productName).Result()
-	if err == nil {
-		// Cache hit
-		log.Println("Cache hit")
-		if err := json.Unmarshal([]byte(val), &product); err == nil {
-			c.JSON(http.StatusOK, product)
-			return
+// hasAttributeFilter reports whether the query filters on attr.* values
+func hasAttributeFilter(c *gin.Context) bool {
+	for key := range c.Request.URL.Query() {
+		if strings.HasPrefix(key, "attr.") {
+			return true
 		}
 	}
+	return false
+}
 
-	// Cache miss, query the database
-	err = db.MI.DB.Collection("products").FindOne(context.TODO(), bson.M{"name": productName}).Decode(&product)
+// GetProduct retrieves a product with its per-warehouse stock, through the
+// Redis cache
+func GetProduct(c *gin.Context) {
+	productName := c.Param("name")
+
+	product, err := cache.Product(context.TODO(), productName, loadProduct)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == cache.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 			return
 		}
@@ -139,14 +350,27 @@ func GetProduct(c *gin.Context) {
 		return
 	}
 
-	// Store result in Redis cache
-	data, err := json.Marshal(product)
-	if err == nil {
-		err = utils.RDB.Set(context.Background(), "product:"+productName, data, 5*time.Minute).Err()
-		if err != nil {
-			log.Printf("Error setting cache: %v", err)
-		}
+	// The cache holds the product in its own currency
+	if localize(c, &product) {
+		c.JSON(http.StatusOK, product)
 	}
+}
 
-	c.JSON(http.StatusOK, product)
+func loadProduct(ctx context.Context, productName string) (*model.Product, error) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOne(ctx, bson.M{"name": productName}).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.Type == model.ProductTypeBundle {
+		return &product, bundle.Resolve(ctx, &product)
+	}
+
+	// Attach the per-warehouse stock behind the aggregated quantity
+	product.Stock, err = inventory.Levels(ctx, productName)
+	if err != nil {
+		log.Printf("Error fetching stock levels: %v", err)
+	}
+	return &product, nil
 }
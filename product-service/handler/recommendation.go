@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"product-service/db"
+	"product-service/model"
+	"product-service/recommend"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetRecommendations lists the products customers who bought a product also
+// bought (limit, default 10)
+func GetRecommendations(c *gin.Context) {
+	productName := c.Param("name")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 50"})
+		return
+	}
+
+	var product model.Product
+	err = db.MI.DB.Collection("products").FindOne(context.TODO(), bson.M{"name": productName}).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching product"})
+		return
+	}
+
+	products, err := recommend.For(context.TODO(), &product, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching recommendations"})
+		return
+	}
+	for i := range products {
+		if !localize(c, &products[i]) {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, products)
+}
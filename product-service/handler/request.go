@@ -0,0 +1,12 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// requestActor identifies who made the request, as forwarded by the caller
+// in the X-User-ID header
+func requestActor(c *gin.Context) string {
+	if actor := c.GetHeader("X-User-ID"); actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
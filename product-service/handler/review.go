@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateReview adds the calling user's review of a product. Reviews start
+// pending moderation and are flagged as a verified purchase when the order
+// service has an order of the product by the same user.
+func CreateReview(c *gin.Context) {
+	productName := c.Param("name")
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "X-User-ID header is required"})
+		return
+	}
+
+	var review model.Review
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := db.MI.DB.Collection("products").CountDocuments(context.TODO(), bson.M{"name": productName})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching product"})
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	verified, err := utils.HasPurchased(userID, productName)
+	if err != nil {
+		// The review is still accepted, it just isn't marked as verified
+		log.Printf("Error checking purchases of %s by %s: %v", productName, userID, err)
+	}
+
+	review.ID = primitive.NilObjectID
+	review.ProductName = productName
+	review.UserID = userID
+	review.VerifiedPurchase = verified
+	review.Status = model.ReviewPending
+	review.HelpfulVotes = 0
+	review.CreatedAt = time.Now().UTC()
+	review.ModeratedAt = nil
+
+	// One review per user per product
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	db.MI.DB.Collection("reviews").Indexes().CreateOne(context.TODO(), indexModel)
+
+	result, err := db.MI.DB.Collection("reviews").InsertOne(context.TODO(), review)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "you have already reviewed this product"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating review"})
+		return
+	}
+	review.ID = result.InsertedID.(primitive.ObjectID)
+	utils.EmitEvents("Review Created")
+
+	c.JSON(http.StatusCreated, review)
+}
+
+// GetReviews lists the approved reviews of a product, newest first or, with
+// sort=helpful, most helpful first
+func GetReviews(c *gin.Context) {
+	productName := c.Param("name")
+
+	sort := bson.D{{Key: "created_at", Value: -1}}
+	if c.Query("sort") == "helpful" {
+		sort = bson.D{{Key: "helpful_votes", Value: -1}, {Key: "created_at", Value: -1}}
+	}
+
+	reviews, err := findReviews(bson.M{"name": productName, "status": model.ReviewApproved}, sort)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// GetModerationQueue lists reviews in a moderation state, pending by default
+func GetModerationQueue(c *gin.Context) {
+	status := c.DefaultQuery("status", model.ReviewPending)
+
+	reviews, err := findReviews(bson.M{"status": status}, bson.D{{Key: "created_at", Value: 1}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching reviews"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// ModerateReview approves or rejects a review and refreshes the product rating
+func ModerateReview(c *gin.Context) {
+	reviewID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+	var input struct {
+		Status string `json:"status" binding:"required,oneof=approved rejected"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var review model.Review
+	err = db.MI.DB.Collection("reviews").FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": reviewID},
+		bson.M{"$set": bson.M{"status": input.Status, "moderated_at": time.Now().UTC()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&review)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error updating review"})
+		return
+	}
+
+	if err := refreshRating(context.TODO(), review.ProductName); err != nil {
+		log.Printf("Error refreshing rating of %s: %v", review.ProductName, err)
+	}
+	utils.EmitEvents("Review Moderated")
+
+	c.JSON(http.StatusOK, review)
+}
+
+// VoteReviewHelpful records that the calling user found a review helpful.
+// Each user can vote once per review and not on their own review.
+func VoteReviewHelpful(c *gin.Context) {
+	userID := c.GetHeader("X-User-ID")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "X-User-ID header is required"})
+		return
+	}
+	reviewID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	var review model.Review
+	err = db.MI.DB.Collection("reviews").FindOne(context.TODO(), bson.M{"_id": reviewID, "status": model.ReviewApproved}).Decode(&review)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "review not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching review"})
+		return
+	}
+	if review.UserID == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you cannot vote on your own review"})
+		return
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "review_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	db.MI.DB.Collection("review_votes").Indexes().CreateOne(context.TODO(), indexModel)
+
+	_, err = db.MI.DB.Collection("review_votes").InsertOne(context.TODO(), bson.M{
+		"review_id":  reviewID,
+		"user_id":    userID,
+		"created_at": time.Now().UTC(),
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "you have already voted on this review"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error recording vote"})
+		return
+	}
+
+	_, err = db.MI.DB.Collection("reviews").UpdateOne(context.TODO(),
+		bson.M{"_id": reviewID},
+		bson.M{"$inc": bson.M{"helpful_votes": 1}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error recording vote"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "vote recorded", "helpful_votes": review.HelpfulVotes + 1})
+}
+
+func findReviews(filter bson.M, sort bson.D) ([]model.Review, error) {
+	cursor, err := db.MI.DB.Collection("reviews").Find(context.TODO(), filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	reviews := []model.Review{}
+	if err := cursor.All(context.TODO(), &reviews); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// refreshRating recomputes the average and count of a product's approved reviews
+func refreshRating(ctx context.Context, productName string) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"name": productName, "status": model.ReviewApproved}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"average": bson.M{"$avg": "$rating"},
+			"count":   bson.M{"$sum": 1},
+		}}},
+	}
+	cursor, err := db.MI.DB.Collection("reviews").Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var results []model.RatingSummary
+	if err := cursor.All(ctx, &results); err != nil {
+		return err
+	}
+
+	summary := model.RatingSummary{}
+	if len(results) > 0 {
+		summary = results[0]
+		summary.Average = math.Round(summary.Average*100) / 100
+	}
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx,
+		bson.M{"name": productName},
+		bson.M{"$set": bson.M{"rating": summary}})
+	if err != nil {
+		return err
+	}
+	utils.InvalidateProduct(productName)
+	return nil
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"product-service/db"
+	"product-service/inventory"
+	"product-service/model"
+	"product-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func CreateWarehouse(c *gin.Context) {
+	var warehouse model.Warehouse
+	if err := c.ShouldBindJSON(&warehouse); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := db.MI.DB.Collection("warehouses").InsertOne(context.TODO(), warehouse)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "warehouse already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error creating warehouse"})
+		return
+	}
+	utils.EmitEvents("Warehouse Created")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Warehouse created successfully", "data": warehouse})
+}
+
+func GetWarehouses(c *gin.Context) {
+	warehouses := []model.Warehouse{}
+
+	cursor, err := db.MI.DB.Collection("warehouses").Find(context.Background(), bson.D{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching warehouses"})
+		return
+	}
+	defer cursor.Close(context.Background())
+	if err := cursor.All(context.Background(), &warehouses); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching warehouses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, warehouses)
+}
+
+// GetWarehouseStock lists the stock of every product held in a warehouse
+func GetWarehouseStock(c *gin.Context) {
+	warehouseID := c.Param("id")
+
+	exists, err := inventory.WarehouseExists(context.TODO(), warehouseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching warehouse"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "warehouse not found"})
+		return
+	}
+
+	levels, err := inventory.WarehouseLevels(context.TODO(), warehouseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, levels)
+}
+
+// TransferStock moves units of a product from one warehouse to another
+func TransferStock(c *gin.Context) {
+	var transfer struct {
+		ProductName string `json:"name" binding:"required"`
+		From        string `json:"from" binding:"required"`
+		To          string `json:"to" binding:"required"`
+		Quantity    int    `json:"quantity" binding:"required,gt=0"`
+	}
+	if err := c.ShouldBindJSON(&transfer); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if transfer.From == transfer.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and destination warehouses must differ"})
+		return
+	}
+
+	exists, err := inventory.WarehouseExists(context.TODO(), transfer.To)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error fetching warehouse"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "warehouse not found"})
+		return
+	}
+
+	err = inventory.Transfer(context.TODO(), transfer.ProductName, transfer.From, transfer.To, transfer.Quantity, inventory.Movement{
+		Reason: model.ReasonTransfer,
+		Actor:  requestActor(c),
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+			return
+		}
+		if errors.Is(err, inventory.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": "insufficient inventory in source warehouse"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	utils.EmitEvents("Stock Transferred")
+
+	c.JSON(http.StatusOK, gin.H{"message": "stock transferred"})
+}
@@ -0,0 +1,98 @@
+package inventory
+
+import (
+	"errors"
+	"math"
+	"os"
+	"product-service/model"
+	"sort"
+)
+
+const (
+	StrategyNearest   = "nearest"
+	StrategyMostStock = "most_stock"
+)
+
+var ErrInsufficientStock = errors.New("insufficient inventory")
+
+// Strategy orders the candidate warehouses for a reservation; stock is taken
+// greedily from the first warehouse onwards
+type Strategy interface {
+	Rank(levels []model.StockLevel, warehouses map[string]model.Warehouse) []model.StockLevel
+}
+
+// MostStock prefers the warehouses holding the most units
+type MostStock struct{}
+
+func (MostStock) Rank(levels []model.StockLevel, _ map[string]model.Warehouse) []model.StockLevel {
+	ranked := append([]model.StockLevel(nil), levels...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Quantity > ranked[j].Quantity
+	})
+	return ranked
+}
+
+// Nearest prefers the warehouses closest to the destination
+type Nearest struct {
+	Destination model.Location
+}
+
+func (n Nearest) Rank(levels []model.StockLevel, warehouses map[string]model.Warehouse) []model.StockLevel {
+	ranked := append([]model.StockLevel(nil), levels...)
+	distance := func(l model.StockLevel) float64 {
+		w, ok := warehouses[l.WarehouseID]
+		if !ok {
+			return math.MaxFloat64
+		}
+		return haversineKm(w.Location, n.Destination)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return distance(ranked[i]) < distance(ranked[j])
+	})
+	return ranked
+}
+
+// NewStrategy returns the strategy with the given name, defaulting to the
+// ALLOCATION_STRATEGY environment variable. Nearest needs a destination, so
+// without one it falls back to most stock.
+func NewStrategy(name string, destination *model.Location) Strategy {
+	if name == "" {
+		name = os.Getenv("ALLOCATION_STRATEGY")
+	}
+	if name == StrategyNearest && destination != nil {
+		return Nearest{Destination: *destination}
+	}
+	return MostStock{}
+}
+
+// Allocate splits quantity across the ranked warehouses
+func Allocate(strategy Strategy, levels []model.StockLevel, warehouses map[string]model.Warehouse, quantity int) ([]model.Allocation, error) {
+	var allocations []model.Allocation
+	remaining := quantity
+	for _, level := range strategy.Rank(levels, warehouses) {
+		if remaining == 0 {
+			break
+		}
+		if level.Quantity <= 0 {
+			continue
+		}
+		take := min(level.Quantity, remaining)
+		allocations = append(allocations, model.Allocation{WarehouseID: level.WarehouseID, Quantity: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return nil, ErrInsufficientStock
+	}
+	return allocations, nil
+}
+
+func haversineKm(a, b model.Location) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(b.Latitude - a.Latitude)
+	dLng := toRad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(a.Latitude))*math.Cos(toRad(b.Latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
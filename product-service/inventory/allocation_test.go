@@ -0,0 +1,144 @@
+package inventory
+
+import (
+	"errors"
+	"product-service/model"
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	warehouses := map[string]model.Warehouse{
+		"paris":  {ID: "paris", Location: model.Location{Latitude: 48.86, Longitude: 2.35}},
+		"berlin": {ID: "berlin", Location: model.Location{Latitude: 52.52, Longitude: 13.40}},
+		"madrid": {ID: "madrid", Location: model.Location{Latitude: 40.42, Longitude: -3.70}},
+	}
+	levels := []model.StockLevel{
+		{WarehouseID: "paris", Quantity: 3},
+		{WarehouseID: "berlin", Quantity: 10},
+		{WarehouseID: "madrid", Quantity: 0},
+	}
+	lyon := model.Location{Latitude: 45.76, Longitude: 4.84}
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		levels   []model.StockLevel
+		quantity int
+		want     []model.Allocation
+		wantErr  error
+	}{
+		{
+			name:     "most stock takes from the fullest warehouse",
+			strategy: MostStock{},
+			levels:   levels,
+			quantity: 4,
+			want:     []model.Allocation{{WarehouseID: "berlin", Quantity: 4}},
+		},
+		{
+			name:     "most stock spills over to the next warehouse",
+			strategy: MostStock{},
+			levels:   levels,
+			quantity: 12,
+			want: []model.Allocation{
+				{WarehouseID: "berlin", Quantity: 10},
+				{WarehouseID: "paris", Quantity: 2},
+			},
+		},
+		{
+			name:     "nearest takes from the closest warehouse first",
+			strategy: Nearest{Destination: lyon},
+			levels:   levels,
+			quantity: 5,
+			want: []model.Allocation{
+				{WarehouseID: "paris", Quantity: 3},
+				{WarehouseID: "berlin", Quantity: 2},
+			},
+		},
+		{
+			name:     "nearest skips empty warehouses",
+			strategy: Nearest{Destination: model.Location{Latitude: 40.0, Longitude: -3.0}},
+			levels:   levels,
+			quantity: 1,
+			want:     []model.Allocation{{WarehouseID: "paris", Quantity: 1}},
+		},
+		{
+			name:     "nearest ranks unknown warehouses last",
+			strategy: Nearest{Destination: lyon},
+			levels: []model.StockLevel{
+				{WarehouseID: "gone", Quantity: 5},
+				{WarehouseID: "berlin", Quantity: 5},
+			},
+			quantity: 6,
+			want: []model.Allocation{
+				{WarehouseID: "berlin", Quantity: 5},
+				{WarehouseID: "gone", Quantity: 1},
+			},
+		},
+		{
+			name:     "exactly the whole stock",
+			strategy: MostStock{},
+			levels:   levels,
+			quantity: 13,
+			want: []model.Allocation{
+				{WarehouseID: "berlin", Quantity: 10},
+				{WarehouseID: "paris", Quantity: 3},
+			},
+		},
+		{
+			name:     "more than the whole stock",
+			strategy: MostStock{},
+			levels:   levels,
+			quantity: 14,
+			wantErr:  ErrInsufficientStock,
+		},
+		{
+			name:     "no stock levels",
+			strategy: MostStock{},
+			quantity: 1,
+			wantErr:  ErrInsufficientStock,
+		},
+		{
+			name:     "nothing to allocate",
+			strategy: MostStock{},
+			levels:   levels,
+			quantity: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Allocate(tt.strategy, tt.levels, warehouses, tt.quantity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("allocations = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	t.Setenv("ALLOCATION_STRATEGY", "")
+	destination := &model.Location{Latitude: 1, Longitude: 2}
+
+	tests := []struct {
+		name        string
+		strategy    string
+		destination *model.Location
+		want        Strategy
+	}{
+		{"default", "", nil, MostStock{}},
+		{"nearest", StrategyNearest, destination, Nearest{Destination: *destination}},
+		{"nearest without a destination", StrategyNearest, nil, MostStock{}},
+		{"unknown", "cheapest", destination, MostStock{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewStrategy(tt.strategy, tt.destination); got != tt.want {
+				t.Errorf("NewStrategy(%q) = %#v, want %#v", tt.strategy, got, tt.want)
+			}
+		})
+	}
+}
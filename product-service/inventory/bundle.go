@@ -0,0 +1,46 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"product-service/model"
+)
+
+// ReserveBundle reserves quantity bundles by reserving their components.
+// Either every component is reserved or none is: when one falls short, the
+// components already taken are put back.
+func ReserveBundle(ctx context.Context, components []model.BundleComponent, quantity int, strategy Strategy, movement Movement) ([]model.Allocation, []*model.Product, error) {
+	var allocations []model.Allocation
+	var products []*model.Product
+	for _, component := range components {
+		taken, product, err := Reserve(ctx, component.ProductName, component.Quantity*quantity, strategy, movement)
+		if err != nil {
+			for _, a := range allocations {
+				if _, err := Adjust(ctx, a.ProductName, a.WarehouseID, a.Quantity, movement); err != nil {
+					log.Printf("Error putting back %d units of %s to %s: %v", a.Quantity, a.ProductName, a.WarehouseID, err)
+				}
+			}
+			return nil, nil, err
+		}
+		for _, a := range taken {
+			a.ProductName = component.ProductName
+			allocations = append(allocations, a)
+		}
+		products = append(products, product)
+	}
+	return allocations, products, nil
+}
+
+// AdjustBundle adds quantity bundles' worth of each component to a
+// warehouse, e.g. when a bundle is returned
+func AdjustBundle(ctx context.Context, components []model.BundleComponent, warehouseID string, quantity int, movement Movement) ([]*model.Product, error) {
+	var products []*model.Product
+	for _, component := range components {
+		product, err := Adjust(ctx, component.ProductName, warehouseID, component.Quantity*quantity, movement)
+		if err != nil {
+			return products, err
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
@@ -0,0 +1,244 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"product-service/db"
+	"product-service/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Movement describes why stock is changing and who changed it
+type Movement struct {
+	Reason      string
+	ReferenceID string
+	Actor       string
+}
+
+// ValidReason reports whether reason can be given by a caller adjusting stock
+func ValidReason(reason string) bool {
+	switch reason {
+	case model.ReasonOrder, model.ReasonRestock, model.ReasonManual, model.ReasonReturn, model.ReasonCancellation:
+		return true
+	}
+	return false
+}
+
+func (m Movement) entry(productName, warehouseID string, delta, balance int) model.LedgerEntry {
+	return model.LedgerEntry{
+		ProductName: productName,
+		WarehouseID: warehouseID,
+		Reason:      m.Reason,
+		ReferenceID: m.ReferenceID,
+		Actor:       m.Actor,
+		Delta:       delta,
+		Balance:     balance,
+		CreatedAt:   time.Now().UTC(),
+	}
+}
+
+// record appends entries to the ledger. The stock change has already been
+// applied by the time this runs, so a failure is logged and picked up by
+// reconciliation rather than undoing the change.
+func record(ctx context.Context, entries ...model.LedgerEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		docs[i] = e
+	}
+	if _, err := db.MI.DB.Collection("ledger").InsertMany(ctx, docs); err != nil {
+		log.Printf("Error writing ledger entries for %s: %v", entries[0].ProductName, err)
+	}
+}
+
+// History returns the ledger entries of a product, newest first
+func History(ctx context.Context, productName string, limit, offset int64) ([]model.LedgerEntry, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(limit).
+		SetSkip(offset)
+
+	cursor, err := db.MI.DB.Collection("ledger").Find(ctx, bson.M{"name": productName}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []model.LedgerEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Reconcile recomputes every balance from the ledger and returns the stored
+// product totals and warehouse levels that do not match it
+func Reconcile(ctx context.Context) ([]model.Discrepancy, error) {
+	type key struct{ name, warehouse string }
+	ledger := make(map[key]int)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"name": "$name", "warehouse_id": "$warehouse_id"},
+			"total": bson.M{"$sum": "$delta"},
+		}}},
+	}
+	cursor, err := db.MI.DB.Collection("ledger").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var sums []struct {
+		ID struct {
+			Name        string `bson:"name"`
+			WarehouseID string `bson:"warehouse_id"`
+		} `bson:"_id"`
+		Total int `bson:"total"`
+	}
+	if err := cursor.All(ctx, &sums); err != nil {
+		return nil, err
+	}
+	for _, s := range sums {
+		ledger[key{s.ID.Name, s.ID.WarehouseID}] += s.Total
+		ledger[key{s.ID.Name, ""}] += s.Total
+	}
+
+	discrepancies := []model.Discrepancy{}
+
+	products, err := db.MI.DB.Collection("products").Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer products.Close(ctx)
+	for products.Next(ctx) {
+		var p model.Product
+		if err := products.Decode(&p); err != nil {
+			return nil, err
+		}
+		if total := ledger[key{p.ProductName, ""}]; total != p.Quantity {
+			discrepancies = append(discrepancies, model.Discrepancy{ProductName: p.ProductName, Recorded: p.Quantity, Ledger: total})
+		}
+	}
+
+	levels, err := findLevels(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range levels {
+		if total := ledger[key{l.ProductName, l.WarehouseID}]; total != l.Quantity {
+			discrepancies = append(discrepancies, model.Discrepancy{ProductName: l.ProductName, WarehouseID: l.WarehouseID, Recorded: l.Quantity, Ledger: total})
+		}
+	}
+
+	return discrepancies, nil
+}
+
+// BackfillOpening gives stock that predates the ledger its opening entry, so
+// reconciliation starts from the stock held when the ledger was introduced.
+// Products without stock levels are seeded. Each warehouse level without an
+// initial entry gets one for what its quantity holds beyond the entries it
+// already has. Levels are only backfilled once, since they have an initial
+// entry afterwards.
+func BackfillOpening(ctx context.Context) error {
+	opts := options.Find().SetProjection(bson.M{"name": 1})
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"type": bson.M{"$ne": model.ProductTypeBundle}}, opts)
+	if err != nil {
+		return err
+	}
+	var products []model.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return err
+	}
+	for _, p := range products {
+		if err := SeedStock(ctx, p.ProductName, "migration"); err != nil {
+			log.Printf("Error seeding stock for %s: %v", p.ProductName, err)
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":    bson.M{"name": "$name", "warehouse_id": "$warehouse_id"},
+			"total":  bson.M{"$sum": "$delta"},
+			"opened": bson.M{"$max": bson.M{"$eq": bson.A{"$reason", model.ReasonInitial}}},
+			"first":  bson.M{"$min": "$created_at"},
+		}}},
+	}
+	cursor, err = db.MI.DB.Collection("ledger").Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var sums []struct {
+		ID struct {
+			Name        string `bson:"name"`
+			WarehouseID string `bson:"warehouse_id"`
+		} `bson:"_id"`
+		Total  int       `bson:"total"`
+		Opened bool      `bson:"opened"`
+		First  time.Time `bson:"first"`
+	}
+	if err := cursor.All(ctx, &sums); err != nil {
+		return err
+	}
+	type key struct{ name, warehouse string }
+	ledger := make(map[key]int)
+	for i, s := range sums {
+		ledger[key{s.ID.Name, s.ID.WarehouseID}] = i
+	}
+
+	levels, err := findLevels(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	opening := Movement{Reason: model.ReasonInitial, Actor: "migration"}
+	backfilled := 0
+	for _, l := range levels {
+		entry := opening.entry(l.ProductName, l.WarehouseID, l.Quantity, l.Quantity)
+		if i, ok := ledger[key{l.ProductName, l.WarehouseID}]; ok {
+			if sums[i].Opened {
+				continue
+			}
+			// The opening entry goes before the entries recorded since
+			entry.Delta = l.Quantity - sums[i].Total
+			entry.Balance = entry.Delta
+			entry.CreatedAt = sums[i].First
+		}
+		// Keyed on the initial reason, so services starting together only
+		// backfill a level once
+		_, err := db.MI.DB.Collection("ledger").UpdateOne(ctx,
+			bson.M{"name": l.ProductName, "warehouse_id": l.WarehouseID, "reason": model.ReasonInitial},
+			bson.M{"$setOnInsert": entry},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Error backfilling the opening entry of %s in %s: %v", l.ProductName, l.WarehouseID, err)
+			continue
+		}
+		backfilled++
+	}
+	if backfilled > 0 {
+		log.Printf("Backfilled %d opening ledger entries", backfilled)
+	}
+	return nil
+}
+
+// RunReconciliation reconciles the ledger every interval and logs what does
+// not add up
+func RunReconciliation(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		discrepancies, err := Reconcile(context.Background())
+		if err != nil {
+			log.Printf("Error reconciling inventory ledger: %v", err)
+			continue
+		}
+		for _, d := range discrepancies {
+			log.Printf("Inventory mismatch for %s %s: recorded %d, ledger %d", d.ProductName, d.WarehouseID, d.Recorded, d.Ledger)
+		}
+		log.Printf("Inventory reconciliation finished with %d discrepancies", len(discrepancies))
+	}
+}
@@ -0,0 +1,56 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckLowStock publishes an inventory.low_stock event when a change of delta
+// took the product from above its reorder threshold to at or below it
+func CheckLowStock(product *model.Product, delta int) {
+	before := product.Quantity - delta
+	if before <= product.ReorderThreshold || product.Quantity > product.ReorderThreshold {
+		return
+	}
+
+	err := utils.PublishEvent(model.EventLowStock, model.LowStockEvent{
+		ProductName:      product.ProductName,
+		Quantity:         product.Quantity,
+		ReorderThreshold: product.ReorderThreshold,
+	})
+	if err != nil {
+		log.Printf("Error publishing low stock event for %s: %v", product.ProductName, err)
+	}
+}
+
+// LowStock returns every product at or below its reorder threshold, emptiest first
+func LowStock(ctx context.Context) ([]model.Product, error) {
+	filter := bson.M{
+		"deleted_at": nil,
+		// Bundles hold no stock, their components are reported instead
+		"type": bson.M{"$ne": model.ProductTypeBundle},
+		"$expr": bson.M{"$lte": bson.A{
+			"$quantity",
+			bson.M{"$ifNull": bson.A{"$reorder_threshold", 0}},
+		}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "quantity", Value: 1}})
+
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	products := []model.Product{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
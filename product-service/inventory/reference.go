@@ -0,0 +1,64 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"product-service/db"
+	"product-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrAlreadyApplied is returned for a change whose reference was already
+// applied
+var ErrAlreadyApplied = errors.New("inventory change already applied for this reference")
+
+// referenceKey identifies a change of a product's stock by its reason,
+// reference and direction, so an order's reservation and its release are
+// different changes
+func referenceKey(productName string, delta int, m Movement) string {
+	direction := "in"
+	if delta < 0 {
+		direction = "out"
+	}
+	return fmt.Sprintf("%s|%s|%s|%s", productName, m.Reason, m.ReferenceID, direction)
+}
+
+// Once applies a change of a product's stock once for its reference, and
+// returns ErrAlreadyApplied if it already was. A caller retrying a change
+// after losing the response, like the order service, doesn't apply it twice.
+// The claim on the reference and the writes apply makes share a transaction:
+// a change that fails, or is cut short, leaves no claim behind, and a retry
+// racing the first attempt waits for it instead of being told it's done.
+// Changes without a reference are always applied.
+func Once(ctx context.Context, productName string, delta int, m Movement, apply func(ctx context.Context) error) error {
+	if m.ReferenceID == "" {
+		return apply(ctx)
+	}
+	err := utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		_, err := db.MI.DB.Collection("inventory_references").InsertOne(ctx, bson.M{
+			"_id":        referenceKey(productName, delta, m),
+			"delta":      delta,
+			"created_at": time.Now().UTC(),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAlreadyApplied
+		}
+		if err != nil {
+			return err
+		}
+		return apply(ctx)
+	})
+	// Without transactions the claim stays when the change fails, so it is
+	// taken back for the change to be retried
+	if err != nil && !errors.Is(err, ErrAlreadyApplied) && !utils.Outbox.Transactional() {
+		if _, unclaimErr := db.MI.DB.Collection("inventory_references").DeleteOne(ctx, bson.M{"_id": referenceKey(productName, delta, m)}); unclaimErr != nil {
+			log.Printf("Error releasing inventory reference for %s: %v", productName, unclaimErr)
+		}
+	}
+	return err
+}
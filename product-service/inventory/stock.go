@@ -0,0 +1,258 @@
+package inventory
+
+import (
+	"context"
+	"log"
+	"product-service/bundle"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Init creates the stock and ledger indexes and makes sure the default warehouse exists
+func Init() error {
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "warehouse_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := db.MI.DB.Collection("stock").Indexes().CreateOne(context.TODO(), indexModel); err != nil {
+		return err
+	}
+
+	ledgerIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: 1}, {Key: "created_at", Value: -1}},
+	}
+	if _, err := db.MI.DB.Collection("ledger").Indexes().CreateOne(context.TODO(), ledgerIndex); err != nil {
+		return err
+	}
+
+	_, err := db.MI.DB.Collection("warehouses").UpdateOne(context.TODO(),
+		bson.M{"_id": model.DefaultWarehouseID},
+		bson.M{"$setOnInsert": bson.M{"name": "Default"}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+// Warehouses returns every warehouse keyed by ID
+func Warehouses(ctx context.Context) (map[string]model.Warehouse, error) {
+	cursor, err := db.MI.DB.Collection("warehouses").Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	warehouses := make(map[string]model.Warehouse)
+	for cursor.Next(ctx) {
+		var w model.Warehouse
+		if err := cursor.Decode(&w); err != nil {
+			return nil, err
+		}
+		warehouses[w.ID] = w
+	}
+	return warehouses, cursor.Err()
+}
+
+// WarehouseExists reports whether a warehouse with the given ID exists
+func WarehouseExists(ctx context.Context, warehouseID string) (bool, error) {
+	count, err := db.MI.DB.Collection("warehouses").CountDocuments(ctx, bson.M{"_id": warehouseID})
+	return count > 0, err
+}
+
+// Levels returns the stock of a product in every warehouse that holds it
+func Levels(ctx context.Context, productName string) ([]model.StockLevel, error) {
+	return findLevels(ctx, bson.M{"name": productName})
+}
+
+// WarehouseLevels returns the stock of every product held in a warehouse
+func WarehouseLevels(ctx context.Context, warehouseID string) ([]model.StockLevel, error) {
+	return findLevels(ctx, bson.M{"warehouse_id": warehouseID})
+}
+
+func findLevels(ctx context.Context, filter bson.M) ([]model.StockLevel, error) {
+	cursor, err := db.MI.DB.Collection("stock").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	levels := []model.StockLevel{}
+	if err := cursor.All(ctx, &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// Adjust changes the stock of a product in one warehouse and keeps the
+// product's aggregated quantity in step, returning the updated product. A
+// negative delta fails with ErrInsufficientStock if the warehouse does not
+// hold enough units.
+func Adjust(ctx context.Context, productName, warehouseID string, delta int, movement Movement) (*model.Product, error) {
+	if err := SeedStock(ctx, productName, movement.Actor); err != nil {
+		return nil, err
+	}
+	if err := adjustLevel(ctx, productName, warehouseID, delta); err != nil {
+		return nil, err
+	}
+	product, err := adjustTotal(ctx, productName, delta)
+	if err != nil {
+		return nil, err
+	}
+
+	if delta != 0 {
+		record(ctx, movement.entry(productName, warehouseID, delta, product.Quantity))
+	}
+	return product, nil
+}
+
+// Reserve takes quantity units of a product out of the warehouses chosen by
+// the strategy. It returns how much was taken from each one and the updated
+// product.
+func Reserve(ctx context.Context, productName string, quantity int, strategy Strategy, movement Movement) ([]model.Allocation, *model.Product, error) {
+	if err := SeedStock(ctx, productName, movement.Actor); err != nil {
+		return nil, nil, err
+	}
+	levels, err := Levels(ctx, productName)
+	if err != nil {
+		return nil, nil, err
+	}
+	warehouses, err := Warehouses(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	allocations, err := Allocate(strategy, levels, warehouses, quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, a := range allocations {
+		if err := adjustLevel(ctx, productName, a.WarehouseID, -a.Quantity); err != nil {
+			// Another reservation got there first, give back what was already taken
+			releaseAllocations(ctx, productName, allocations[:i])
+			return nil, nil, err
+		}
+	}
+	product, err := adjustTotal(ctx, productName, -quantity)
+	if err != nil {
+		releaseAllocations(ctx, productName, allocations)
+		return nil, nil, err
+	}
+
+	// One entry per warehouse, each carrying the balance right after it
+	entries := make([]model.LedgerEntry, 0, len(allocations))
+	balance := product.Quantity + quantity
+	for _, a := range allocations {
+		balance -= a.Quantity
+		entries = append(entries, movement.entry(productName, a.WarehouseID, -a.Quantity, balance))
+	}
+	record(ctx, entries...)
+	return allocations, product, nil
+}
+
+// Transfer moves stock of a product between two warehouses. The aggregated
+// quantity of the product does not change.
+func Transfer(ctx context.Context, productName, from, to string, quantity int, movement Movement) error {
+	if err := SeedStock(ctx, productName, movement.Actor); err != nil {
+		return err
+	}
+	if err := adjustLevel(ctx, productName, from, -quantity); err != nil {
+		return err
+	}
+	if err := adjustLevel(ctx, productName, to, quantity); err != nil {
+		if rollbackErr := adjustLevel(ctx, productName, from, quantity); rollbackErr != nil {
+			log.Printf("Error rolling back transfer of %s from %s: %v", productName, from, rollbackErr)
+		}
+		return err
+	}
+
+	var product model.Product
+	if err := db.MI.DB.Collection("products").FindOne(ctx, bson.M{"name": productName}).Decode(&product); err != nil {
+		return err
+	}
+	record(ctx,
+		movement.entry(productName, from, -quantity, product.Quantity),
+		movement.entry(productName, to, quantity, product.Quantity))
+	return nil
+}
+
+func adjustLevel(ctx context.Context, productName, warehouseID string, delta int) error {
+	filter := bson.M{"name": productName, "warehouse_id": warehouseID}
+	update := bson.M{"$inc": bson.M{"quantity": delta}}
+
+	if delta < 0 {
+		filter["quantity"] = bson.M{"$gte": -delta}
+		result, err := db.MI.DB.Collection("stock").UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrInsufficientStock
+		}
+		utils.InvalidateProduct(productName)
+		return nil
+	}
+
+	_, err := db.MI.DB.Collection("stock").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	utils.InvalidateProduct(productName)
+	return nil
+}
+
+func adjustTotal(ctx context.Context, productName string, delta int) (*model.Product, error) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOneAndUpdate(ctx,
+		bson.M{"name": productName},
+		bson.M{"$inc": bson.M{"quantity": delta}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	utils.InvalidateProduct(productName)
+	bundle.InvalidateContaining(ctx, productName)
+	return &product, nil
+}
+
+func releaseAllocations(ctx context.Context, productName string, allocations []model.Allocation) {
+	for _, a := range allocations {
+		if err := adjustLevel(ctx, productName, a.WarehouseID, a.Quantity); err != nil {
+			log.Printf("Error releasing %d units of %s to %s: %v", a.Quantity, productName, a.WarehouseID, err)
+		}
+	}
+}
+
+// SeedStock puts the whole quantity of a product that has no stock levels yet
+// into the default warehouse and records it as the opening ledger entry. It
+// covers newly created products as well as products created before
+// warehouses existed, so the per-warehouse levels always add up to the
+// product total.
+func SeedStock(ctx context.Context, productName, actor string) error {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOne(ctx, bson.M{"name": productName}).Decode(&product)
+	if err != nil {
+		return err
+	}
+
+	count, err := db.MI.DB.Collection("stock").CountDocuments(ctx, bson.M{"name": productName})
+	if err != nil || count > 0 {
+		return err
+	}
+
+	result, err := db.MI.DB.Collection("stock").UpdateOne(ctx,
+		bson.M{"name": productName, "warehouse_id": model.DefaultWarehouseID},
+		bson.M{"$setOnInsert": bson.M{"quantity": product.Quantity}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if result.UpsertedCount > 0 {
+		utils.InvalidateProduct(productName)
+		opening := Movement{Reason: model.ReasonInitial, Actor: actor}
+		record(ctx, opening.entry(productName, model.DefaultWarehouseID, product.Quantity, product.Quantity))
+	}
+	return nil
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"product-service/archive"
+	"product-service/catalog"
+	"product-service/currency"
 	"product-service/db"
 	"product-service/handler"
+	"product-service/inventory"
+	"product-service/media"
 	"product-service/metrics"
 	"product-service/middleware"
+	"product-service/pricing"
+	"product-service/recommend"
 	"product-service/utils"
+	"shared/auth"
+	"shared/idempotency"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,19 +29,140 @@ func main() {
 	if err != nil {
 		log.Fatal("error connecting to the database: ", err)
 	}
+	if err = inventory.Init(); err != nil {
+		log.Fatal("error initialising inventory: ", err)
+	}
+	if err = pricing.Init(); err != nil {
+		log.Fatal("error initialising pricing: ", err)
+	}
+	if err = catalog.Init(); err != nil {
+		log.Fatal("error initialising categories: ", err)
+	}
+
+	if ratesFile := os.Getenv("RATES_FILE"); ratesFile != "" {
+		if err = currency.LoadRates(ratesFile); err != nil {
+			log.Fatal("error loading exchange rates: ", err)
+		}
+	}
 
 	metrics.Init()
 	utils.InitRedis()
 	utils.InitMQ()
 	defer utils.CloseMQ()
 
+	// Relay events from the outbox to RabbitMQ
+	outboxInterval := time.Second
+	if v := os.Getenv("OUTBOX_INTERVAL"); v != "" {
+		if outboxInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid OUTBOX_INTERVAL: ", err)
+		}
+	}
+	if err = utils.InitOutbox(db.MI.DB, outboxInterval); err != nil {
+		log.Fatal("error initialising the outbox: ", err)
+	}
+	if err = recommend.Start(); err != nil {
+		log.Fatal("error subscribing to order events: ", err)
+	}
+
+	reconcileInterval := time.Hour
+	if v := os.Getenv("RECONCILE_INTERVAL"); v != "" {
+		if reconcileInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid RECONCILE_INTERVAL: ", err)
+		}
+	}
+	if err := inventory.BackfillOpening(context.TODO()); err != nil {
+		log.Printf("Error backfilling opening ledger entries: %v", err)
+	}
+	go inventory.RunReconciliation(reconcileInterval)
+
+	priceInterval := 30 * time.Second
+	if v := os.Getenv("PRICE_SCHEDULER_INTERVAL"); v != "" {
+		if priceInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid PRICE_SCHEDULER_INTERVAL: ", err)
+		}
+	}
+	go pricing.RunScheduler(priceInterval)
+
+	purgeInterval := time.Hour
+	if v := os.Getenv("PURGE_INTERVAL"); v != "" {
+		if purgeInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid PURGE_INTERVAL: ", err)
+		}
+	}
+	retention := 30 * 24 * time.Hour
+	if v := os.Getenv("ARCHIVE_RETENTION"); v != "" {
+		if retention, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid ARCHIVE_RETENTION: ", err)
+		}
+	}
+	go archive.RunPurge(purgeInterval, retention)
+
+	imageDir := os.Getenv("IMAGE_DIR")
+	if imageDir == "" {
+		imageDir = "./uploads"
+	}
+	imageBaseURL := os.Getenv("IMAGE_BASE_URL")
+	if imageBaseURL == "" {
+		imageBaseURL = "http://localhost:8082/images"
+	}
+	media.Store = media.LocalStorage{Dir: imageDir, BaseURL: imageBaseURL}
+
+	// Key of the tokens the user service signs, shared by every service
+	secret, err := auth.Secret()
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.AuthSecret = secret
+
+	// Responses kept for retries sent with an Idempotency-Key
+	idempotencyTTL := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		if idempotencyTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatal("invalid IDEMPOTENCY_TTL: ", err)
+		}
+	}
+
 	router := gin.Default()
 	router.Use(middleware.PrometheusMiddleware())
+	router.Use(auth.Middleware(secret))
 	router.GET("/metrics", metrics.PrometheusHandler)
-	router.POST("/product", handler.CreateProduct)
+	router.Static("/images", imageDir)
+	router.POST("/product", idempotency.Middleware(utils.RDB, idempotencyTTL), handler.CreateProduct)
 	router.GET("/product/:name", handler.GetProduct)
 	router.GET("/products", handler.GetProducts)
+	router.GET("/products/low-stock", handler.GetLowStockProducts)
+	router.GET("/products/archived", auth.RequireAdmin(), handler.GetArchivedProducts)
+	router.POST("/products/import", handler.ImportProducts)
+	router.GET("/products/export", handler.ExportProducts)
 	router.PUT("/product/:name", handler.UpdateProduct)
 	router.DELETE("/product/:name", handler.DeleteProduct)
+	router.POST("/product/:name/restore", auth.RequireAdmin(), handler.RestoreProduct)
+	router.PUT("/product/:name/threshold", handler.SetReorderThreshold)
+	router.GET("/product/:name/ledger", handler.GetLedger)
+	router.GET("/product/:name/recommendations", handler.GetRecommendations)
+	router.POST("/product/:name/images", handler.UploadProductImages)
+	router.PUT("/product/:name/images", handler.ReorderProductImages)
+	router.DELETE("/product/:name/images/:imageId", handler.DeleteProductImage)
+	router.PUT("/product/:name/images/:imageId/primary", handler.SetPrimaryImage)
+	router.POST("/inventory/reconcile", handler.ReconcileInventory)
+	router.PUT("/product/:name/price", handler.SetPrice)
+	router.PUT("/product/:name/price-list", handler.SetPriceList)
+	router.POST("/product/:name/sales", handler.ScheduleSale)
+	router.GET("/product/:name/prices", handler.GetPrices)
+	router.DELETE("/price-change/:id", handler.CancelPriceChange)
+	router.POST("/product/:name/reviews", handler.CreateReview)
+	router.GET("/product/:name/reviews", handler.GetReviews)
+	router.POST("/review/:id/helpful", handler.VoteReviewHelpful)
+	router.GET("/reviews", auth.RequireAdmin(), handler.GetModerationQueue)
+	router.PUT("/review/:id/moderate", auth.RequireAdmin(), handler.ModerateReview)
+	router.PUT("/product/:name/attributes", handler.SetProductAttributes)
+	router.POST("/category", auth.RequireAdmin(), handler.CreateCategory)
+	router.GET("/categories", handler.GetCategories)
+	router.GET("/category/:name", handler.GetCategory)
+	router.PUT("/category/:name", auth.RequireAdmin(), handler.UpdateCategory)
+	router.POST("/warehouse", handler.CreateWarehouse)
+	router.GET("/warehouses", handler.GetWarehouses)
+	router.GET("/warehouse/:id/stock", handler.GetWarehouseStock)
+	router.POST("/stock/transfer", handler.TransferStock)
 	router.Run(":8082")
 }
@@ -0,0 +1,53 @@
+package media
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage is where uploaded images and their thumbnails are kept. Keys are
+// slash separated paths such as "<product>/<image>/original.jpg", so an
+// S3-compatible backend can use them as object keys unchanged.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	Delete(ctx context.Context, prefix string) error
+	URL(key string) string
+}
+
+// Store is the storage backend used by the service
+var Store Storage
+
+// LocalStorage keeps images on the local filesystem under Dir. The service
+// serves Dir at BaseURL.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+}
+
+func (s LocalStorage) Put(_ context.Context, key string, r io.Reader, _ string) error {
+	path := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Delete removes every object stored under prefix
+func (s LocalStorage) Delete(_ context.Context, prefix string) error {
+	return os.RemoveAll(filepath.Join(s.Dir, filepath.FromSlash(prefix)))
+}
+
+func (s LocalStorage) URL(key string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + key
+}
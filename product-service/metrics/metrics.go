@@ -23,12 +23,30 @@ var (
 		},
 		[]string{"path", "method"},
 	)
+
+	CacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_hits_total",
+			Help: "Count of reads served from the Redis cache",
+		},
+		[]string{"cache"},
+	)
+
+	CacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_misses_total",
+			Help: "Count of reads that missed the Redis cache",
+		},
+		[]string{"cache"},
+	)
 )
 
 func Init() {
 	// Register the metrics
 	prometheus.MustRegister(HttpRequestCounter)
 	prometheus.MustRegister(HttpRequestDuration)
+	prometheus.MustRegister(CacheHits)
+	prometheus.MustRegister(CacheMisses)
 }
 
 func PrometheusHandler(c *gin.Context) {
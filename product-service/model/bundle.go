@@ -0,0 +1,22 @@
+package model
+
+const ProductTypeBundle = "bundle"
+
+// Bundle pricing modes
+const (
+	BundlePriceFixed    = "fixed"
+	BundlePriceDiscount = "discount"
+)
+
+// BundleComponent is a product and how many of it one bundle contains
+type BundleComponent struct {
+	ProductName string `json:"name" bson:"name"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+}
+
+// BundlePricing sets how a bundle is priced: at its own fixed price, or at
+// Percent off the sum of its components' prices
+type BundlePricing struct {
+	Mode    string  `json:"mode" bson:"mode"`
+	Percent float64 `json:"percent,omitempty" bson:"percent,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Attribute types
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeEnum    = "enum"
+	AttributeBoolean = "boolean"
+)
+
+// Category defines the attributes products in it can carry
+type Category struct {
+	Name        string         `json:"name" bson:"name" binding:"required"`
+	Description string         `json:"description,omitempty" bson:"description,omitempty"`
+	Attributes  []AttributeDef `json:"attributes" bson:"attributes"`
+	UpdatedAt   time.Time      `json:"updated_at" bson:"updated_at"`
+}
+
+// AttributeDef describes one attribute. Numbers are stored in Unit, which
+// values given in another unit of the same kind are converted to.
+type AttributeDef struct {
+	Name     string   `json:"name" bson:"name" binding:"required"`
+	Type     string   `json:"type" bson:"type" binding:"required,oneof=string number enum boolean"`
+	Unit     string   `json:"unit,omitempty" bson:"unit,omitempty"`
+	Values   []string `json:"values,omitempty" bson:"values,omitempty"`
+	Required bool     `json:"required" bson:"required"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const EventLowStock = "inventory.low_stock"
+
+// LowStockEvent is published when a product's quantity drops to or below
+// its reorder threshold
+type LowStockEvent struct {
+	ProductName      string `json:"name"`
+	Quantity         int    `json:"quantity"`
+	ReorderThreshold int    `json:"reorder_threshold"`
+}
+
+const EventPriceChanged = "product.price_changed"
+
+// PriceChangedEvent is published whenever the price charged for a product changes
+type PriceChangedEvent struct {
+	ProductName string    `json:"name"`
+	OldPrice    Money     `json:"old_price"`
+	NewPrice    Money     `json:"new_price"`
+	Reason      string    `json:"reason"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
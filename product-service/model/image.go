@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+type Thumbnail struct {
+	Size string `json:"size" bson:"size"`
+	URL  string `json:"url" bson:"url"`
+}
+
+// ProductImage is an uploaded image of a product. Images are shown in
+// ascending Position order and at most one of them is Primary.
+type ProductImage struct {
+	ID          string      `json:"id" bson:"id"`
+	URL         string      `json:"url" bson:"url"`
+	Thumbnails  []Thumbnail `json:"thumbnails" bson:"thumbnails"`
+	ContentType string      `json:"content_type" bson:"content_type"`
+	Size        int64       `json:"size" bson:"size"`
+	Position    int         `json:"position" bson:"position"`
+	Primary     bool        `json:"primary" bson:"primary"`
+	CreatedAt   time.Time   `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reasons a stock level can change
+const (
+	ReasonInitial      = "initial"
+	ReasonOrder        = "order"
+	ReasonRestock      = "restock"
+	ReasonManual       = "manual"
+	ReasonReturn       = "return"
+	ReasonTransfer     = "transfer"
+	ReasonCancellation = "cancellation"
+)
+
+// LedgerEntry is one append-only record of a stock change. Balance is the
+// product's aggregated quantity right after the change.
+type LedgerEntry struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductName string             `json:"name" bson:"name"`
+	WarehouseID string             `json:"warehouse_id" bson:"warehouse_id"`
+	Reason      string             `json:"reason" bson:"reason"`
+	ReferenceID string             `json:"reference_id,omitempty" bson:"reference_id,omitempty"`
+	Actor       string             `json:"actor" bson:"actor"`
+	Delta       int                `json:"delta" bson:"delta"`
+	Balance     int                `json:"balance" bson:"balance"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Discrepancy is a stored quantity that does not match the sum of its ledger
+// entries. WarehouseID is empty for the product's aggregated quantity.
+type Discrepancy struct {
+	ProductName string `json:"name"`
+	WarehouseID string `json:"warehouse_id,omitempty"`
+	Recorded    int    `json:"recorded"`
+	Ledger      int    `json:"ledger"`
+}
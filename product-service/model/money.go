@@ -0,0 +1,8 @@
+package model
+
+// Money is an amount in the minor units of an ISO 4217 currency, e.g.
+// {Amount: 1999, Currency: "USD"} is $19.99
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
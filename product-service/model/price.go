@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of scheduled price change
+const (
+	PriceChangeRegular = "regular"
+	PriceChangeSale    = "sale"
+)
+
+// States of a scheduled price change. A regular change goes from scheduled to
+// applied; a sale goes from scheduled to active to ended.
+const (
+	PriceScheduled = "scheduled"
+	PriceApplied   = "applied"
+	PriceActive    = "active"
+	PriceEnded     = "ended"
+	PriceCancelled = "cancelled"
+)
+
+// PriceChange is a price change that takes effect at EffectiveAt. A sale
+// also reverts to the regular price at EndsAt.
+type PriceChange struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductName string             `json:"name" bson:"name"`
+	Kind        string             `json:"kind" bson:"kind"`
+	Price       Money              `json:"price" bson:"price"`
+	EffectiveAt time.Time          `json:"effective_at" bson:"effective_at"`
+	EndsAt      *time.Time         `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Actor       string             `json:"actor" bson:"actor"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// PriceHistoryEntry records a change of the price charged for a product
+type PriceHistoryEntry struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductName string              `json:"name" bson:"name"`
+	OldPrice    Money               `json:"old_price" bson:"old_price"`
+	NewPrice    Money               `json:"new_price" bson:"new_price"`
+	Reason      string              `json:"reason" bson:"reason"`
+	ChangeID    *primitive.ObjectID `json:"change_id,omitempty" bson:"change_id,omitempty"`
+	Actor       string              `json:"actor" bson:"actor"`
+	EffectiveAt time.Time           `json:"effective_at" bson:"effective_at"`
+}
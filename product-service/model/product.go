@@ -1,9 +1,28 @@
 package model
 
+import "time"
+
+// Product is an entry of the catalogue. ImagesVersion is bumped on every
+// change to Images, so concurrent image changes don't overwrite each other.
 type Product struct {
-	ID          string  `json:"id" bson:"_id,omitempty"`
-	ProductName string  `json:"name" bson:"name"`
-	Description string  `json:"description" bson:"description"`
-	Price       float64 `json:"price" bson:"price"`
-	Quantity    int     `json:"quantity" bson:"quantity"`
+	ID               string                 `json:"id" bson:"_id,omitempty"`
+	ProductName      string                 `json:"name" bson:"name"`
+	SKU              string                 `json:"sku,omitempty" bson:"sku,omitempty"`
+	Description      string                 `json:"description" bson:"description"`
+	Type             string                 `json:"type,omitempty" bson:"type,omitempty"`
+	Components       []BundleComponent      `json:"components,omitempty" bson:"components,omitempty"`
+	BundlePricing    *BundlePricing         `json:"bundle_pricing,omitempty" bson:"bundle_pricing,omitempty"`
+	Category         string                 `json:"category,omitempty" bson:"category,omitempty"`
+	Attributes       map[string]interface{} `json:"attributes,omitempty" bson:"attributes,omitempty"`
+	Price            Money                  `json:"price" bson:"price"`
+	RegularPrice     Money                  `json:"regular_price" bson:"regular_price"`
+	PriceList        []Money                `json:"price_list,omitempty" bson:"price_list,omitempty"`
+	ActiveSale       *PriceChange           `json:"active_sale,omitempty" bson:"active_sale,omitempty"`
+	Quantity         int                    `json:"quantity" bson:"quantity"`
+	ReorderThreshold int                    `json:"reorder_threshold" bson:"reorder_threshold"`
+	Rating           RatingSummary          `json:"rating" bson:"rating"`
+	Images           []ProductImage         `json:"images,omitempty" bson:"images,omitempty"`
+	ImagesVersion    int                    `json:"-" bson:"images_version,omitempty"`
+	Stock            []StockLevel           `json:"stock,omitempty" bson:"-"`
+	DeletedAt        *time.Time             `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 }
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Moderation states of a review. Only approved reviews are shown and counted
+// in the product rating.
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductName      string             `json:"name" bson:"name"`
+	UserID           string             `json:"user_id" bson:"user_id"`
+	Rating           int                `json:"rating" bson:"rating" binding:"required,min=1,max=5"`
+	Title            string             `json:"title" bson:"title" binding:"max=200"`
+	Text             string             `json:"text" bson:"text" binding:"max=5000"`
+	VerifiedPurchase bool               `json:"verified_purchase" bson:"verified_purchase"`
+	Status           string             `json:"status" bson:"status"`
+	HelpfulVotes     int                `json:"helpful_votes" bson:"helpful_votes"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	ModeratedAt      *time.Time         `json:"moderated_at,omitempty" bson:"moderated_at,omitempty"`
+}
+
+// RatingSummary aggregates the approved reviews of a product
+type RatingSummary struct {
+	Average float64 `json:"average" bson:"average"`
+	Count   int     `json:"count" bson:"count"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// DefaultWarehouseID is the warehouse that receives stock when no warehouse is specified
+const DefaultWarehouseID = "default"
+
+type Location struct {
+	Latitude  float64 `json:"lat" bson:"lat"`
+	Longitude float64 `json:"lng" bson:"lng"`
+}
+
+type Warehouse struct {
+	ID       string   `json:"id" bson:"_id" binding:"required"`
+	Name     string   `json:"name" bson:"name" binding:"required"`
+	Location Location `json:"location" bson:"location"`
+}
+
+// StockLevel is the quantity of a single product held in a single warehouse
+type StockLevel struct {
+	ProductName string `json:"name" bson:"name"`
+	WarehouseID string `json:"warehouse_id" bson:"warehouse_id"`
+	Quantity    int    `json:"quantity" bson:"quantity"`
+}
+
+// Allocation is the part of a reservation taken from one warehouse
+type Allocation struct {
+	ProductName string `json:"name,omitempty"`
+	WarehouseID string `json:"warehouse_id"`
+	Quantity    int    `json:"quantity"`
+}
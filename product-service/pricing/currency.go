@@ -0,0 +1,135 @@
+package pricing
+
+import (
+	"context"
+	"log"
+	"product-service/currency"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PriceIn returns what a product costs in the given currency. An explicit
+// price list entry wins unless a sale is running, in which case the sale
+// price is converted so customers in every currency get the discount.
+func PriceIn(product *model.Product, code string) (model.Money, error) {
+	if product.ActiveSale != nil {
+		return currency.Convert(product.Price, code)
+	}
+	return listPrice(product.Price, product.PriceList, code)
+}
+
+// Localize sets the prices of a product to its prices in the given currency.
+// The price list is left out since it no longer applies.
+func Localize(product *model.Product, code string) error {
+	price, err := PriceIn(product, code)
+	if err != nil {
+		return err
+	}
+	regular, err := listPrice(regularPrice(product), product.PriceList, code)
+	if err != nil {
+		return err
+	}
+	product.Price = price
+	product.RegularPrice = regular
+	product.PriceList = nil
+	return nil
+}
+
+func listPrice(price model.Money, list []model.Money, code string) (model.Money, error) {
+	if code == price.Currency {
+		return price, nil
+	}
+	for _, entry := range list {
+		if entry.Currency == code {
+			return entry, nil
+		}
+	}
+	return currency.Convert(price, code)
+}
+
+// SetPriceList replaces the explicit prices of a product in other currencies
+// and records a history entry for every entry that changed
+func SetPriceList(ctx context.Context, productName string, prices []model.Money, actor string) error {
+	product, err := findProduct(ctx, productName)
+	if err != nil {
+		return err
+	}
+	for _, price := range prices {
+		if price.Currency == product.Price.Currency {
+			return ErrCurrencyMismatch
+		}
+	}
+
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx,
+		bson.M{"name": productName},
+		bson.M{"$set": bson.M{"price_list": prices}})
+	if err != nil {
+		return err
+	}
+	utils.InvalidateProduct(productName)
+
+	old := make(map[string]model.Money, len(product.PriceList))
+	for _, price := range product.PriceList {
+		old[price.Currency] = price
+	}
+	for _, price := range prices {
+		previous, ok := old[price.Currency]
+		if !ok {
+			previous = model.Money{Currency: price.Currency}
+		}
+		if previous != price {
+			recordChange(ctx, productName, previous, price, ReasonPriceList, actor, nil)
+		}
+		delete(old, price.Currency)
+	}
+	for _, removed := range old {
+		recordChange(ctx, productName, removed, model.Money{Currency: removed.Currency}, ReasonPriceList, actor, nil)
+	}
+	return nil
+}
+
+// migrateMoney converts prices stored as plain numbers before prices carried
+// a currency to minor units of the base currency
+func migrateMoney(ctx context.Context) {
+	base := currency.Base()
+	unit := 1
+	for i := 0; i < currency.Exponent(base); i++ {
+		unit *= 10
+	}
+	toMoney := func(field string) bson.M {
+		return bson.M{"$cond": bson.A{
+			bson.M{"$isNumber": "$" + field},
+			bson.M{
+				"amount":   bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$" + field, unit}}, 0}}},
+				"currency": base,
+			},
+			"$" + field,
+		}}
+	}
+
+	migrations := []struct {
+		collection string
+		fields     []string
+	}{
+		{"products", []string{"price", "regular_price", "active_sale.price"}},
+		{"price_changes", []string{"price"}},
+		{"price_history", []string{"old_price", "new_price"}},
+	}
+	for _, m := range migrations {
+		for _, field := range m.fields {
+			result, err := db.MI.DB.Collection(m.collection).UpdateMany(ctx,
+				bson.M{field: bson.M{"$type": "number"}},
+				bson.A{bson.M{"$set": bson.M{field: toMoney(field)}}})
+			if err != nil {
+				log.Printf("Error migrating %s.%s to money: %v", m.collection, field, err)
+				continue
+			}
+			if result.ModifiedCount > 0 {
+				log.Printf("Migrated %d %s.%s values to %s", result.ModifiedCount, m.collection, field, base)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"product-service/bundle"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reasons recorded in the price history
+const (
+	ReasonManual    = "manual"
+	ReasonScheduled = "scheduled"
+	ReasonSaleStart = "sale_start"
+	ReasonSaleEnd   = "sale_end"
+	ReasonImport    = "import"
+	ReasonPriceList = "price_list"
+)
+
+var (
+	ErrOverlappingSale  = errors.New("sale overlaps another sale of the product")
+	ErrNotCancellable   = errors.New("price change has already taken effect")
+	ErrCurrencyMismatch = errors.New("price must be in the product's currency")
+)
+
+// SetRegularPrice changes the regular price of a product now. While a sale is
+// active the product keeps being charged at the sale price, and the new
+// regular price applies when the sale ends.
+func SetRegularPrice(ctx context.Context, productName string, price model.Money, reason, actor string, changeID *primitive.ObjectID) error {
+	product, err := findProduct(ctx, productName)
+	if err != nil {
+		return err
+	}
+	if price.Currency != product.Price.Currency {
+		return ErrCurrencyMismatch
+	}
+
+	fields := bson.M{"regular_price": price}
+	if product.ActiveSale == nil {
+		fields["price"] = price
+	}
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx, bson.M{"name": productName}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	utils.InvalidateProduct(productName)
+
+	if product.ActiveSale == nil && product.Price != price {
+		recordChange(ctx, productName, product.Price, price, reason, actor, changeID)
+	}
+	return nil
+}
+
+// Schedule stores a regular price change or a sale. Changes that are already
+// due are applied straight away.
+func Schedule(ctx context.Context, change model.PriceChange) (model.PriceChange, error) {
+	product, err := findProduct(ctx, change.ProductName)
+	if err != nil {
+		return change, err
+	}
+	if change.Price.Currency != product.Price.Currency {
+		return change, ErrCurrencyMismatch
+	}
+	if change.Kind == model.PriceChangeSale {
+		overlapping, err := db.MI.DB.Collection("price_changes").CountDocuments(ctx, bson.M{
+			"name":         change.ProductName,
+			"kind":         model.PriceChangeSale,
+			"status":       bson.M{"$in": bson.A{model.PriceScheduled, model.PriceActive}},
+			"effective_at": bson.M{"$lt": change.EndsAt},
+			"ends_at":      bson.M{"$gt": change.EffectiveAt},
+		})
+		if err != nil {
+			return change, err
+		}
+		if overlapping > 0 {
+			return change, ErrOverlappingSale
+		}
+	}
+
+	change.ID = primitive.NewObjectID()
+	change.Status = model.PriceScheduled
+	change.CreatedAt = time.Now().UTC()
+	if _, err := db.MI.DB.Collection("price_changes").InsertOne(ctx, change); err != nil {
+		return change, err
+	}
+
+	if !change.EffectiveAt.After(time.Now()) {
+		ApplyDue(ctx, time.Now())
+		if err := db.MI.DB.Collection("price_changes").FindOne(ctx, bson.M{"_id": change.ID}).Decode(&change); err != nil {
+			return change, err
+		}
+	}
+	return change, nil
+}
+
+// Cancel withdraws a scheduled change. An active sale is ended immediately;
+// an applied change can no longer be cancelled.
+func Cancel(ctx context.Context, id primitive.ObjectID) (model.PriceChange, error) {
+	var change model.PriceChange
+	err := db.MI.DB.Collection("price_changes").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": model.PriceScheduled},
+		bson.M{"$set": bson.M{"status": model.PriceCancelled}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&change)
+	if err == nil {
+		return change, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return change, err
+	}
+
+	err = db.MI.DB.Collection("price_changes").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": model.PriceActive},
+		bson.M{"$set": bson.M{"status": model.PriceEnded}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&change)
+	if err == nil {
+		return change, endSale(ctx, change)
+	}
+	if err != mongo.ErrNoDocuments {
+		return change, err
+	}
+
+	count, err := db.MI.DB.Collection("price_changes").CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return change, err
+	}
+	if count == 0 {
+		return change, mongo.ErrNoDocuments
+	}
+	return change, ErrNotCancellable
+}
+
+// Pending returns the scheduled and active changes of a product, soonest first
+func Pending(ctx context.Context, productName string) ([]model.PriceChange, error) {
+	cursor, err := db.MI.DB.Collection("price_changes").Find(ctx,
+		bson.M{"name": productName, "status": bson.M{"$in": bson.A{model.PriceScheduled, model.PriceActive}}},
+		options.Find().SetSort(bson.D{{Key: "effective_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []model.PriceChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// History returns every change of the price charged for a product, newest first
+func History(ctx context.Context, productName string) ([]model.PriceHistoryEntry, error) {
+	cursor, err := db.MI.DB.Collection("price_history").Find(ctx,
+		bson.M{"name": productName},
+		options.Find().SetSort(bson.D{{Key: "effective_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []model.PriceHistoryEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func startSale(ctx context.Context, change model.PriceChange) error {
+	product, err := findProduct(ctx, change.ProductName)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx,
+		bson.M{"name": change.ProductName},
+		bson.M{"$set": bson.M{
+			"price":         change.Price,
+			"regular_price": regularPrice(product),
+			"active_sale":   change,
+		}})
+	if err != nil {
+		return err
+	}
+
+	recordChange(ctx, change.ProductName, product.Price, change.Price, ReasonSaleStart, change.Actor, &change.ID)
+	return nil
+}
+
+func endSale(ctx context.Context, change model.PriceChange) error {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOne(ctx,
+		bson.M{"name": change.ProductName, "active_sale._id": change.ID}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		// The sale is no longer the one running on the product
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	regular := regularPrice(&product)
+	_, err = db.MI.DB.Collection("products").UpdateOne(ctx,
+		bson.M{"name": change.ProductName, "active_sale._id": change.ID},
+		bson.M{
+			"$set":   bson.M{"price": regular},
+			"$unset": bson.M{"active_sale": ""},
+		})
+	if err != nil {
+		return err
+	}
+
+	recordChange(ctx, change.ProductName, product.Price, regular, ReasonSaleEnd, change.Actor, &change.ID)
+	return nil
+}
+
+// recordChange appends to the price history, drops the cached product and
+// publishes a product.price_changed event. The history entry and the event
+// are written in one transaction.
+func recordChange(ctx context.Context, productName string, oldPrice, newPrice model.Money, reason, actor string, changeID *primitive.ObjectID) {
+	now := time.Now().UTC()
+	err := utils.Outbox.Transact(ctx, func(ctx context.Context) error {
+		_, err := db.MI.DB.Collection("price_history").InsertOne(ctx, model.PriceHistoryEntry{
+			ProductName: productName,
+			OldPrice:    oldPrice,
+			NewPrice:    newPrice,
+			Reason:      reason,
+			ChangeID:    changeID,
+			Actor:       actor,
+			EffectiveAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		return utils.StageEvent(ctx, model.EventPriceChanged, model.PriceChangedEvent{
+			ProductName: productName,
+			OldPrice:    oldPrice,
+			NewPrice:    newPrice,
+			Reason:      reason,
+			EffectiveAt: now,
+		})
+	})
+	if err != nil {
+		log.Printf("Error recording price change of %s: %v", productName, err)
+	}
+
+	utils.InvalidateProduct(productName)
+	bundle.InvalidateContaining(ctx, productName)
+}
+
+func findProduct(ctx context.Context, productName string) (*model.Product, error) {
+	var product model.Product
+	err := db.MI.DB.Collection("products").FindOne(ctx, bson.M{"name": productName}).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// regularPrice falls back to the charged price for products created before
+// regular prices were tracked
+func regularPrice(product *model.Product) model.Money {
+	if product.RegularPrice.Currency == "" {
+		return product.Price
+	}
+	return product.RegularPrice
+}
@@ -0,0 +1,111 @@
+package pricing
+
+import (
+	"context"
+	"log"
+	"product-service/db"
+	"product-service/model"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Init converts prices stored before they carried a currency and creates
+// the indexes the scheduler and history queries rely on
+func Init() error {
+	migrateMoney(context.TODO())
+
+	indexes := map[string]mongo.IndexModel{
+		"price_changes": {Keys: bson.D{{Key: "status", Value: 1}, {Key: "effective_at", Value: 1}}},
+		"price_history": {Keys: bson.D{{Key: "name", Value: 1}, {Key: "effective_at", Value: -1}}},
+	}
+	for collection, indexModel := range indexes {
+		if _, err := db.MI.DB.Collection(collection).Indexes().CreateOne(context.TODO(), indexModel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunScheduler applies due price changes and ends expired sales every interval
+func RunScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ApplyDue(context.Background(), time.Now())
+	}
+}
+
+// ApplyDue applies every change that is due at now. Each change is claimed
+// with a conditional status update first, so when several replicas run the
+// scheduler a change is still applied exactly once.
+func ApplyDue(ctx context.Context, now time.Time) {
+	// Sales that ended before they were ever started are closed without
+	// touching the price
+	_, err := db.MI.DB.Collection("price_changes").UpdateMany(ctx,
+		bson.M{"kind": model.PriceChangeSale, "status": model.PriceScheduled, "ends_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"status": model.PriceEnded}})
+	if err != nil {
+		log.Printf("Error closing expired sales: %v", err)
+	}
+
+	// End running sales before starting new ones, so back to back sales hand over cleanly
+	for {
+		change, ok := claim(ctx,
+			bson.M{"kind": model.PriceChangeSale, "status": model.PriceActive, "ends_at": bson.M{"$lte": now}},
+			model.PriceEnded)
+		if !ok {
+			break
+		}
+		if err := endSale(ctx, change); err != nil {
+			log.Printf("Error ending sale %s of %s: %v", change.ID.Hex(), change.ProductName, err)
+		}
+	}
+
+	for {
+		change, ok := claim(ctx,
+			bson.M{"status": model.PriceScheduled, "effective_at": bson.M{"$lte": now}},
+			"")
+		if !ok {
+			break
+		}
+		if change.Kind == model.PriceChangeSale {
+			change.Status = model.PriceActive
+			err = startSale(ctx, change)
+		} else {
+			err = SetRegularPrice(ctx, change.ProductName, change.Price, ReasonScheduled, change.Actor, &change.ID)
+		}
+		if err != nil {
+			log.Printf("Error applying price change %s of %s: %v", change.ID.Hex(), change.ProductName, err)
+		}
+	}
+}
+
+// claim moves one change matching filter to status and returns it as it was
+// before the update. An empty status moves sales to active and regular
+// changes to applied.
+func claim(ctx context.Context, filter bson.M, status string) (model.PriceChange, bool) {
+	var update interface{}
+	if status != "" {
+		update = bson.M{"$set": bson.M{"status": status}}
+	} else {
+		update = mongo.Pipeline{{{Key: "$set", Value: bson.M{"status": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$kind", model.PriceChangeSale}},
+			model.PriceActive,
+			model.PriceApplied,
+		}}}}}}
+	}
+
+	var change model.PriceChange
+	err := db.MI.DB.Collection("price_changes").FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "effective_at", Value: 1}})).Decode(&change)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error claiming price change: %v", err)
+		}
+		return change, false
+	}
+	return change, true
+}
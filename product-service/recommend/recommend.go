@@ -0,0 +1,199 @@
+package recommend
+
+import (
+	"context"
+	"encoding/json"
+	"product-service/db"
+	"product-service/model"
+	"product-service/utils"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	eventOrderCreated = "order.created"
+
+	// processedTTL is how long an order is remembered so a redelivered
+	// event is not counted twice
+	processedTTL = 7 * 24 * time.Hour
+)
+
+type orderCreated struct {
+	OrderID string `json:"order_id"`
+	UserID  string `json:"user_id"`
+	Items   []struct {
+		ProductName string `json:"name"`
+		Quantity    int    `json:"quantity"`
+	} `json:"items"`
+}
+
+func coPurchaseKey(productName string) string { return "reco:copurchase:" + productName }
+func bestsellersKey(category string) string   { return "reco:bestsellers:" + category }
+func purchasesKey(userID string) string       { return "reco:purchases:" + userID }
+
+// Start consumes order-created events to keep the co-purchase counts and
+// bestseller lists up to date
+func Start() error {
+	return utils.Subscribe("product_service.recommendations", func(event utils.Event) error {
+		if event.Type != eventOrderCreated {
+			return nil
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		var order orderCreated
+		if err := json.Unmarshal(data, &order); err != nil {
+			return err
+		}
+		return record(context.Background(), order)
+	})
+}
+
+// record counts the products of an order as bought together with each other
+// and with everything the same customer bought before, and adds them to the
+// bestsellers of their category. The order is marked processed in the same
+// transaction as the counts, so a redelivered event is counted once, and an
+// event whose counts failed is counted when it comes back.
+func record(ctx context.Context, order orderCreated) error {
+	var names []string
+	for _, item := range order.Items {
+		names = append(names, item.ProductName)
+	}
+	categories, err := categoriesOf(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	// Watching the marker makes a concurrent delivery of the same order fail
+	// with redis.TxFailedErr instead of counting it again
+	var processed string
+	var watch []string
+	if order.OrderID != "" {
+		processed = "reco:order:" + order.OrderID
+		watch = append(watch, processed)
+	}
+	return utils.RDB.Watch(ctx, func(tx *redis.Tx) error {
+		if processed != "" {
+			done, err := tx.Exists(ctx, processed).Result()
+			if err != nil || done > 0 {
+				return err
+			}
+		}
+		previous := []string{}
+		if order.UserID != "" {
+			var err error
+			if previous, err = tx.SMembers(ctx, purchasesKey(order.UserID)).Result(); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, item := range order.Items {
+				// Pairs within the order are visited from both ends
+				for j, other := range order.Items {
+					if i != j && other.ProductName != item.ProductName {
+						pipe.ZIncrBy(ctx, coPurchaseKey(item.ProductName), 1, other.ProductName)
+					}
+				}
+				for _, other := range previous {
+					if other != item.ProductName {
+						pipe.ZIncrBy(ctx, coPurchaseKey(item.ProductName), 1, other)
+						pipe.ZIncrBy(ctx, coPurchaseKey(other), 1, item.ProductName)
+					}
+				}
+				pipe.ZIncrBy(ctx, bestsellersKey(categories[item.ProductName]), float64(item.Quantity), item.ProductName)
+				if order.UserID != "" {
+					pipe.SAdd(ctx, purchasesKey(order.UserID), item.ProductName)
+				}
+			}
+			if processed != "" {
+				pipe.Set(ctx, processed, 1, processedTTL)
+			}
+			return nil
+		})
+		return err
+	}, watch...)
+}
+
+// For returns up to limit products bought together with a product, most
+// often first. When there is too little co-purchase data the rest are the
+// bestsellers of the product's category.
+func For(ctx context.Context, product *model.Product, limit int) ([]model.Product, error) {
+	exclude := map[string]bool{product.ProductName: true}
+	var names []string
+	add := func(candidates []string) {
+		for _, name := range candidates {
+			if !exclude[name] {
+				exclude[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	// Fetch extra candidates since archived products are dropped below
+	stop := int64(2*limit - 1)
+	candidates, err := utils.RDB.ZRevRange(ctx, coPurchaseKey(product.ProductName), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	add(candidates)
+	if len(names) <= int(stop) {
+		candidates, err = utils.RDB.ZRevRange(ctx, bestsellersKey(product.Category), 0, stop).Result()
+		if err != nil {
+			return nil, err
+		}
+		add(candidates)
+	}
+
+	products, err := liveProducts(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	recommendations := []model.Product{}
+	for _, name := range names {
+		if p, ok := products[name]; ok && len(recommendations) < limit {
+			recommendations = append(recommendations, p)
+		}
+	}
+	return recommendations, nil
+}
+
+func categoriesOf(ctx context.Context, names []string) (map[string]string, error) {
+	categories := make(map[string]string, len(names))
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"name": bson.M{"$in": names}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var p model.Product
+		if err := cursor.Decode(&p); err != nil {
+			return nil, err
+		}
+		categories[p.ProductName] = p.Category
+	}
+	return categories, cursor.Err()
+}
+
+func liveProducts(ctx context.Context, names []string) (map[string]model.Product, error) {
+	products := make(map[string]model.Product, len(names))
+	if len(names) == 0 {
+		return products, nil
+	}
+	cursor, err := db.MI.DB.Collection("products").Find(ctx, bson.M{"name": bson.M{"$in": names}, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var p model.Product
+		if err := cursor.Decode(&p); err != nil {
+			return nil, err
+		}
+		products[p.ProductName] = p
+	}
+	return products, cursor.Err()
+}
@@ -46,3 +46,29 @@ func GetKey(key string) (string, error) {
 	log.Printf("Key %s retrieved successfully", key)
 	return val, nil
 }
+
+// generationTTL keeps a product's cache generation well past any load that
+// could have read it
+const generationTTL = 10 * time.Minute
+
+// ProductGenerationKey holds a counter bumped on every invalidation of a
+// product. A load only caches what it read if the counter hasn't moved
+// since, so it can't put back a copy older than the last change.
+func ProductGenerationKey(productName string) string {
+	return "product:gen:" + productName
+}
+
+// InvalidateProduct removes the cached copy of a product so the next read
+// goes to the database
+func InvalidateProduct(productName string) {
+	genKey := ProductGenerationKey(productName)
+	_, err := RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, genKey)
+		pipe.Expire(ctx, genKey, generationTTL)
+		pipe.Del(ctx, "product:"+productName)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error invalidating cache for product %s: %v", productName, err)
+	}
+}
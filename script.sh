@@ -71,6 +71,12 @@ else
     fi
 fi
 
+# The services sign and verify login tokens with a shared secret
+if [ -z "$JWT_SECRET" ]; then
+    echo "Error: JWT_SECRET is not set. Export a random secret, e.g. export JWT_SECRET=\$(openssl rand -hex 32)"
+    exit 1
+fi
+
 # Get the base directory
 BASE_DIR=$(pwd)
 
@@ -0,0 +1,207 @@
+// Package idempotency makes POST endpoints safe to retry. A request sent with
+// an Idempotency-Key header is handled once; retries with the same key, from
+// the same user and with the same body get the first response replayed.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const Header = "Idempotency-Key"
+
+// maxKeyLength bounds the keys clients can make us store
+const maxKeyLength = 255
+
+// lockTTL is how long a request holds its key without renewing it. The key
+// is renewed every lockRefresh while the request runs, so it is only
+// released for retries when the process dies.
+const (
+	lockTTL     = time.Minute
+	lockRefresh = lockTTL / 3
+)
+
+const (
+	stateInFlight = "in_flight"
+	stateDone     = "done"
+)
+
+// record is what is stored under a key
+type record struct {
+	State       string `json:"state"`
+	Hash        string `json:"hash"`
+	Token       string `json:"token,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Middleware stores the first response to each idempotency key in Redis for
+// ttl. Retries of a request still running get 409, and reusing a key for a
+// different request gets 422. Server errors aren't stored, so the request can
+// be retried with the same key.
+func Middleware(rdb *redis.Client, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(Header)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		user := c.GetHeader("X-User-ID")
+		sum := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		hash := hex.EncodeToString(sum[:])
+		redisKey := "idempotency:" + c.FullPath() + ":" + user + ":" + key
+		ctx := context.Background()
+
+		inFlight, claimed, err := claim(ctx, rdb, redisKey, hash)
+		if err != nil {
+			// Without Redis, handle the request rather than refuse it
+			log.Printf("Error claiming idempotency key: %v", err)
+			c.Next()
+			return
+		}
+		if !claimed {
+			replay(ctx, c, rdb, redisKey, hash)
+			return
+		}
+
+		// Renewals after the response is stored find the key no longer in
+		// flight and leave it alone
+		defer keepAlive(ctx, rdb, redisKey, inFlight)()
+		w := &recorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			if err := rdb.Del(ctx, redisKey).Err(); err != nil {
+				log.Printf("Error releasing idempotency key: %v", err)
+			}
+			return
+		}
+		done, _ := json.Marshal(record{
+			State:       stateDone,
+			Hash:        hash,
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+		})
+		if err := rdb.Set(ctx, redisKey, done, ttl).Err(); err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+}
+
+// claim marks the key as in flight for this request if nobody holds it,
+// returning the in-flight record that identifies the request
+func claim(ctx context.Context, rdb *redis.Client, redisKey, hash string) (string, bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", false, err
+	}
+	inFlight, _ := json.Marshal(record{State: stateInFlight, Hash: hash, Token: hex.EncodeToString(token)})
+	claimed, err := rdb.SetNX(ctx, redisKey, inFlight, lockTTL).Result()
+	return string(inFlight), claimed, err
+}
+
+// renewScript extends the key only while it still holds the request's own
+// in-flight record
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// keepAlive renews the claim on the key until the returned func is called
+func keepAlive(ctx context.Context, rdb *redis.Client, redisKey, inFlight string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := renewScript.Run(ctx, rdb, []string{redisKey}, inFlight, lockTTL.Milliseconds()).Err()
+				if err != nil {
+					log.Printf("Error renewing idempotency key: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// replay answers a retry from what the first request stored
+func replay(ctx context.Context, c *gin.Context, rdb *redis.Client, redisKey, hash string) {
+	data, err := rdb.Get(ctx, redisKey).Bytes()
+	if err == redis.Nil {
+		// Released between our claim and now
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is being retried, try again"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error reading idempotency key"})
+		return
+	}
+	var stored record
+	if err := json.Unmarshal(data, &stored); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "error reading idempotency key"})
+		return
+	}
+
+	switch {
+	case stored.Hash != hash:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+	case stored.State == stateInFlight:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(stored.Status, stored.ContentType, stored.Body)
+		c.Abort()
+	}
+}
+
+// recorder keeps a copy of the response body as it is written
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
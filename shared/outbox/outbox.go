@@ -0,0 +1,160 @@
+// Package outbox publishes events reliably through a transactional outbox.
+// Events are written to an outbox collection in the same Mongo transaction
+// as the change they describe, and a relay publishes them to RabbitMQ,
+// marking each sent once the broker confirms it. Delivery is at least once,
+// so consumers should tolerate duplicates (each message carries its ID).
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Message statuses
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+)
+
+// Message is an event waiting in, or relayed from, the outbox
+type Message struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	Exchange    string             `bson:"exchange"`
+	RoutingKey  string             `bson:"routing_key"`
+	Body        []byte             `bson:"body"`
+	Status      string             `bson:"status"`
+	Attempts    int                `bson:"attempts"`
+	LastError   string             `bson:"last_error,omitempty"`
+	LockedUntil time.Time          `bson:"locked_until"`
+	CreatedAt   time.Time          `bson:"created_at"`
+	SentAt      *time.Time         `bson:"sent_at,omitempty"`
+}
+
+// Event is the envelope of typed events
+type Event struct {
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Outbox is the outbox collection of one service database
+type Outbox struct {
+	client       *mongo.Client
+	collection   *mongo.Collection
+	transactions bool
+	wake         chan struct{}
+}
+
+// Retention is how long sent messages are kept before Mongo deletes them
+var Retention = 7 * 24 * time.Hour
+
+// New sets up the outbox collection of a database and its indexes. Writes
+// are only transactional when the server is part of a replica set or a
+// sharded cluster; on a standalone server they are applied one by one.
+func New(ctx context.Context, database *mongo.Database) (*Outbox, error) {
+	o := &Outbox{
+		client:     database.Client(),
+		collection: database.Collection("outbox"),
+		wake:       make(chan struct{}, 1),
+	}
+	_, err := o.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "sent_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(Retention.Seconds()))},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := database.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, err
+	}
+	o.transactions = hello.SetName != "" || hello.Msg == "isdbgrid"
+	if !o.transactions {
+		log.Println("Mongo is standalone, outbox writes are not transactional")
+	}
+	return o, nil
+}
+
+// Transact runs fn in a Mongo transaction. Writes fn makes with the context
+// it is given, including Enqueue, commit or abort together. fn may be run
+// more than once if the transaction is retried.
+func (o *Outbox) Transact(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	if o.transactions {
+		var session mongo.Session
+		session, err = o.client.StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+	} else {
+		err = fn(ctx)
+	}
+	if err == nil {
+		o.notify()
+	}
+	return err
+}
+
+// Transactional reports whether Transact runs fn in a transaction, which
+// needs a replica set or a sharded cluster
+func (o *Outbox) Transactional() bool {
+	return o.transactions
+}
+
+// Enqueue adds a message to the outbox. Called with a context from Transact
+// it is part of that transaction.
+func (o *Outbox) Enqueue(ctx context.Context, exchange, routingKey string, body []byte) error {
+	now := time.Now().UTC()
+	_, err := o.collection.InsertOne(ctx, Message{
+		ID:         primitive.NewObjectID(),
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Body:       body,
+		Status:     StatusPending,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return err
+	}
+	if mongo.SessionFromContext(ctx) == nil {
+		o.notify()
+	}
+	return nil
+}
+
+// EnqueueEvent wraps data in a typed Event and adds it to the outbox, with
+// the event type as the routing key
+func (o *Outbox) EnqueueEvent(ctx context.Context, exchange, eventType string, data interface{}) error {
+	body, err := json.Marshal(Event{
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+	return o.Enqueue(ctx, exchange, eventType, body)
+}
+
+// notify wakes the relay without waiting for its next poll
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,137 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lease is how long a relay holds a message it is publishing, so relays of
+// several replicas don't publish the same message at once
+const lease = 30 * time.Second
+
+const confirmTimeout = 10 * time.Second
+
+// Relay publishes pending messages in the order they were written, every
+// interval and whenever a new message is added, until ctx is done. open
+// returns a channel to publish on; a new one is opened after each failure.
+func (o *Outbox) Relay(ctx context.Context, open func() (*amqp.Channel, error), interval time.Duration) {
+	for {
+		if err := o.relay(ctx, open); err != nil {
+			log.Printf("Error relaying outbox: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// relay publishes pending messages until there are none left or one fails
+func (o *Outbox) relay(ctx context.Context, open func() (*amqp.Channel, error)) error {
+	ch, err := open()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return err
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	declared := make(map[string]bool)
+
+	for {
+		msg, err := o.claim(ctx)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if !declared[msg.Exchange] && msg.Exchange != "" {
+			if err := ch.ExchangeDeclare(msg.Exchange, "fanout", true, false, false, false, nil); err != nil {
+				o.release(ctx, msg, err)
+				return err
+			}
+			declared[msg.Exchange] = true
+		}
+		if err := publish(ch, confirms, msg); err != nil {
+			o.release(ctx, msg, err)
+			return err
+		}
+		now := time.Now().UTC()
+		_, err = o.collection.UpdateByID(ctx, msg.ID, bson.M{
+			"$set":   bson.M{"status": StatusSent, "sent_at": now},
+			"$inc":   bson.M{"attempts": 1},
+			"$unset": bson.M{"last_error": ""},
+		})
+		if err != nil {
+			// It will be published again once its lease runs out
+			return err
+		}
+	}
+}
+
+// claim takes the lease of the oldest pending message nobody holds
+func (o *Outbox) claim(ctx context.Context) (*Message, error) {
+	now := time.Now().UTC()
+	var msg Message
+	err := o.collection.FindOneAndUpdate(ctx,
+		bson.M{"status": StatusPending, "locked_until": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After)).Decode(&msg)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// release gives up the lease of a message that couldn't be published so it
+// is retried
+func (o *Outbox) release(ctx context.Context, msg *Message, cause error) {
+	_, err := o.collection.UpdateByID(ctx, msg.ID, bson.M{
+		"$set": bson.M{"locked_until": time.Time{}, "last_error": cause.Error()},
+		"$inc": bson.M{"attempts": 1},
+	})
+	if err != nil {
+		log.Printf("Error releasing outbox message %s: %v", msg.ID.Hex(), err)
+	}
+}
+
+// publish sends a message and waits for the broker to confirm it
+func publish(ch *amqp.Channel, confirms <-chan amqp.Confirmation, msg *Message) error {
+	err := ch.Publish(msg.Exchange, msg.RoutingKey, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID.Hex(),
+		Timestamp:    msg.CreatedAt,
+		Body:         msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case confirm, ok := <-confirms:
+		if !ok {
+			return errors.New("channel closed before the broker confirmed")
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("broker rejected message %s", msg.ID.Hex())
+		}
+		return nil
+	case <-time.After(confirmTimeout):
+		return fmt.Errorf("broker didn't confirm message %s in time", msg.ID.Hex())
+	}
+}
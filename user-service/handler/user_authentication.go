@@ -40,7 +40,7 @@ func AuthenticateUser(c *gin.Context) {
 	}
 
 	//Generate JWT token
-	token, err := utils.GenerateToken(user.Email, user.Password)
+	token, err := utils.GenerateToken(user.ID.Hex(), user.Email, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
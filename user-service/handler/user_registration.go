@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/mail"
+	"shared/auth"
 	"user-service/db"
 	"user-service/model"
 	"user-service/utils"
@@ -30,6 +31,7 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 	user.Password = hashedPassword
+	user.Role = auth.RoleCustomer
 	if len(user.ID) == 0 {
 		user.ID = primitive.NewObjectID()
 	}
@@ -41,19 +43,25 @@ func RegisterUser(c *gin.Context) {
 	}
 	db.MI.DB.Collection("users").Indexes().CreateOne(context.TODO(), indexModel)
 
-	// insert user into db
-	_, err = db.MI.DB.Collection("users").InsertOne(c, user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User already exists"})
-		return
-	}
+	// insert user into db, together with its events
 	userJson, _ := json.Marshal(user)
-	err = utils.EmitEvent("user", string(userJson))
+	err = utils.Outbox.Transact(c, func(ctx context.Context) error {
+		if _, err := db.MI.DB.Collection("users").InsertOne(ctx, user); err != nil {
+			return err
+		}
+		if err := utils.StageEvent(ctx, "user", string(userJson)); err != nil {
+			return err
+		}
+		return utils.StageEvent(ctx, "User Created ", string(userJson))
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error emitting event"})
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 		return
 	}
-	utils.EmitEvent("User Created ", string(userJson))
 	c.JSON(http.StatusOK, user)
 }
 
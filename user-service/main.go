@@ -2,6 +2,10 @@ package main
 
 import (
 	"log"
+	"os"
+	"shared/auth"
+	"shared/idempotency"
+	"time"
 	"user-service/db"
 	"user-service/handler"
 	"user-service/metrics"
@@ -21,14 +25,37 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error connecting to RabbitMQ: %v", err)
 	}
+	outboxInterval := time.Second
+	if v := os.Getenv("OUTBOX_INTERVAL"); v != "" {
+		if outboxInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid OUTBOX_INTERVAL: %v", err)
+		}
+	}
+	err = utils.InitOutbox(db.MI.DB, outboxInterval)
+	if err != nil {
+		log.Fatalf("Error initialising the outbox: %v", err)
+	}
 	metrics.Init()
 	utils.InitRedis()
 	defer utils.CloseMQ()
 
+	// Key of the login tokens, shared with the services that verify them
+	if utils.JWTSecret, err = auth.Secret(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Responses kept for retries sent with an Idempotency-Key
+	idempotencyTTL := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		if idempotencyTTL, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("Invalid IDEMPOTENCY_TTL: %v", err)
+		}
+	}
+
 	router := gin.Default()
 	router.Use(middleware.PrometheusMiddleware())
 	router.GET("/metrics", metrics.PrometheusHandler)
-	router.POST("/register", handler.RegisterUser)
+	router.POST("/register", idempotency.Middleware(utils.RDB, idempotencyTTL), handler.RegisterUser)
 	router.POST("/login", handler.AuthenticateUser)
 	router.GET("/users", handler.GetUsers)
 	router.GET("/user/:email", handler.GetUser)
@@ -2,9 +2,12 @@ package model
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// User is a registered account. Role is "customer" unless an admin was
+// promoted in the database; it can't be chosen at registration.
 type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
 	Name     string             `json:"name" bson:"name" binding:"required"`
 	Email    string             `json:"email" bson:"email" binding:"required,email"`
 	Password string             `json:"password" bson:"password" binding:"required,min=6"`
+	Role     string             `json:"role,omitempty" bson:"role,omitempty"`
 }
@@ -1,54 +1,21 @@
 package utils
 
 import (
-	"errors"
-	"fmt"
+	"shared/auth"
 	"time"
-
-	"github.com/golang-jwt/jwt/v4"
 )
 
-var jwtKey = []byte("your_secret_key")
+// JWTSecret signs the login tokens. It is set from JWT_SECRET at startup and
+// shared with the services that verify the tokens.
+var JWTSecret []byte
 
-// GenerateJWT generates a JWT for user authentication
-func GenerateToken(email string, password string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":    email,
-		"password": password,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+const tokenTTL = 24 * time.Hour
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
-		return "", err
+// GenerateToken issues the login token of a user, carrying their ID and role.
+// Users without a role are customers.
+func GenerateToken(userID, email, role string) (string, error) {
+	if role == "" {
+		role = auth.RoleCustomer
 	}
-
-	return tokenString, nil
-}
-
-// Claims defines the structure of the JWT claims
-type Claims struct {
-	Email string `json:"email"`
-	jwt.StandardClaims
-}
-
-func VerifyJWT(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
-			return nil, errors.New("invalid token signature")
-		}
-		return nil, errors.New("invalid token")
-	}
-
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	return claims, nil
+	return auth.NewToken(JWTSecret, userID, email, role, tokenTTL)
 }
@@ -1,14 +1,21 @@
 package utils
 
 import (
+	"context"
 	"log"
+	"shared/outbox"
+	"time"
 
 	"github.com/streadway/amqp"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var MQConnection *amqp.Connection
 var MQChannel *amqp.Channel
 
+// Outbox holds events until they are published
+var Outbox *outbox.Outbox
+
 // InitMQ initializes the RabbitMQ connection and channel
 func InitMQ(uri string) error {
 	var err error
@@ -37,36 +44,27 @@ func CloseMQ() {
 	log.Println("RabbitMQ connection and channel closed")
 }
 
-// EmitEvent publishes an event to the specified RabbitMQ exchange
-func EmitEvent(exchangeName, event string) error {
-	ch, err := MQConnection.Channel()
+// InitOutbox sets up the outbox in the service database and starts relaying
+// it to RabbitMQ every interval
+func InitOutbox(database *mongo.Database, interval time.Duration) error {
+	var err error
+	Outbox, err = outbox.New(context.TODO(), database)
 	if err != nil {
 		return err
 	}
-	defer ch.Close()
+	go Outbox.Relay(context.Background(), func() (*amqp.Channel, error) {
+		return MQConnection.Channel()
+	}, interval)
+	return nil
+}
 
-	err = ch.ExchangeDeclare(
-		exchangeName, // name
-		"fanout",     // type
-		true,         // durable
-		false,        // auto-deleted
-		false,        // internal
-		false,        // no-wait
-		nil,          // arguments
-	)
-	if err != nil {
-		return err
-	}
+// EmitEvent queues an event for publishing to the specified RabbitMQ exchange
+func EmitEvent(exchangeName, event string) error {
+	return StageEvent(context.TODO(), exchangeName, event)
+}
 
-	err = ch.Publish(
-		exchangeName, // exchange
-		"",           // routing key
-		false,        // mandatory
-		false,        // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        []byte(event),
-		},
-	)
-	return err
+// StageEvent writes an event for the specified exchange to the outbox as
+// part of the transaction of ctx, if any
+func StageEvent(ctx context.Context, exchangeName, event string) error {
+	return Outbox.Enqueue(ctx, exchangeName, "", []byte(event))
 }